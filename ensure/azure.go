@@ -0,0 +1,97 @@
+package ensure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/jmhodges/yaml.v2"
+)
+
+// AzureUpdater updates the "version" input of every GoTool task in an Azure
+// Pipelines config. Steps can live at the top level or inside of jobs and
+// stages, so the whole document is searched for them.
+type AzureUpdater struct{}
+
+func (AzureUpdater) Name() string        { return "azure" }
+func (AzureUpdater) Description() string { return "Azure Pipelines config file" }
+
+func (AzureUpdater) Patterns() []string {
+	return []string{"azure-pipelines.yml", "azure-pipelines.yaml"}
+}
+
+func (AzureUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	var ay yaml.MapSlice
+	err := yaml.Unmarshal(contents, &ay)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse YAML Azure Pipelines config file %#v: %s", fp, err)
+	}
+
+	lines := yamlLineNumbers(contents)
+	var pins []Pin
+	var walkErr error
+	walkMapSlicePaths(ay, "", func(path string, obj yaml.MapSlice) {
+		inputs, j, err := findAzureGoToolVersion(obj)
+		if err != nil && walkErr == nil {
+			walkErr = err
+		}
+		if j == -1 || err != nil {
+			return
+		}
+		versionPath := yamlPath(path, "inputs.version")
+		start, end, ok := yamlScalarAt(contents, lines, versionPath)
+		version := inputs[j].Value
+		if !ok || !azureVersionIs(string(contents[start:end]), version) {
+			walkErr = fmt.Errorf("unable to find GoTool version %#v", fmt.Sprint(version))
+			return
+		}
+		pins = append(pins, Pin{string(contents[start:end]), start, end})
+	})
+	if walkErr != nil {
+		return nil, fmt.Errorf("unable to parse YAML Azure Pipelines config file %#v: %s", fp, walkErr)
+	}
+	return pins, nil
+}
+
+// Edits updates the versions as they're written in the file, since unquoted
+// ones like 1.20 are decoded as the float 1.2.
+func (u AzureUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, quoteYAMLNumber(contents)), nil
+}
+
+// azureVersionIs reports whether the version written as s in the source is
+// the decoded version. Unquoted versions like 1.10 are decoded as floats, so
+// they're compared by their values.
+func azureVersionIs(s string, version interface{}) bool {
+	if f, isFloat := version.(float64); isFloat {
+		v, err := strconv.ParseFloat(s, 64)
+		return err == nil && v == f
+	}
+	return s == fmt.Sprint(version)
+}
+
+// findAzureGoToolVersion returns the inputs of obj and the index of their
+// version if obj is a GoTool task, or -1 if it's not or has no version.
+func findAzureGoToolVersion(obj yaml.MapSlice) (yaml.MapSlice, int, error) {
+	i, task, err := findMapItem(obj, "task")
+	if err != nil {
+		return nil, -1, err
+	}
+	taskName, ok := task.(string)
+	if i == -1 || !ok || !strings.HasPrefix(taskName, "GoTool@") {
+		return nil, -1, nil
+	}
+	_, inputs, err := findMapItemAsMapSlice(obj, "inputs")
+	if err != nil {
+		return nil, -1, err
+	}
+	j, _, err := findMapItem(inputs, "version")
+	if err != nil {
+		return nil, -1, err
+	}
+	return inputs, j, nil
+}
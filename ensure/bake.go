@@ -0,0 +1,133 @@
+package ensure
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BakeUpdater updates the Go versions in the HCL files of docker buildx bake,
+// like
+//
+//	variable "GO_VERSION" {
+//	  default = "1.21.5"
+//	}
+//
+//	target "app" {
+//	  args = {
+//	    GO_VERSION = GO_VERSION
+//	  }
+//	}
+//
+// The defaults of GO_VERSION and GOLANG_VERSION variables and the values of
+// those args that are string literals are updated the same way as the ARG
+// instructions of Dockerfiles are, and the defaults of other variables are
+// updated if they're golang images, like "golang:1.21-alpine". Only the
+// versions are changed, so the rest of the file is left as it is.
+type BakeUpdater struct{}
+
+func (BakeUpdater) Name() string        { return "bake" }
+func (BakeUpdater) Description() string { return "Bake file" }
+
+// Patterns match the HCL files that docker buildx bake reads by default.
+func (BakeUpdater) Patterns() []string {
+	return []string{"**/docker-bake.hcl", "**/docker-bake.override.hcl"}
+}
+
+func (BakeUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	toks, err := tokenizeHCL(contents)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse HCL Bake file %#v: %s", fp, err)
+	}
+	var pins []Pin
+	for i := 0; i < len(toks); i++ {
+		if i > 0 && !toks[i-1].is(hclPunct, "\n") && !toks[i-1].is(hclPunct, "{") && !toks[i-1].is(hclPunct, "}") {
+			continue
+		}
+		switch {
+		case toks[i].is(hclIdent, "variable") && i+2 < len(toks) && toks[i+2].is(hclPunct, "{"):
+			label := toks[i+1]
+			if label.kind != hclIdent && (label.kind != hclString || label.template) {
+				continue
+			}
+			for _, attr := range hclAttrs(toks[i+3:]) {
+				if attr.name != "default" {
+					continue
+				}
+				p, ok := goVersionVarPin(attr.value.text, attr.value.start+1)
+				if !goVersionVars[label.text] {
+					p, ok = golangImagePin(attr.value.text, attr.value.start+1)
+				}
+				if ok {
+					pins = append(pins, p)
+				}
+			}
+		case toks[i].is(hclIdent, "args") && i+2 < len(toks) && hclIsAssign(toks[i+1]) && toks[i+2].is(hclPunct, "{"):
+			for _, attr := range hclAttrs(toks[i+3:]) {
+				if !goVersionVars[attr.name] {
+					continue
+				}
+				if p, ok := goVersionVarPin(attr.value.text, attr.value.start+1); ok {
+					pins = append(pins, p)
+				}
+			}
+		}
+	}
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].Start < pins[j].Start })
+	return pins, nil
+}
+
+func (u BakeUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, golangTagPinVersion), nil
+}
+
+// hclAttr is an attribute of an HCL block or an item of an object whose value
+// is a string literal.
+type hclAttr struct {
+	name  string
+	value hclToken
+}
+
+// hclAttrs returns the attributes with string literal values directly inside
+// of the block or object whose body starts at toks. Ones with other values,
+// like variables or templates, and the ones of nested blocks and objects are
+// left out.
+func hclAttrs(toks []hclToken) []hclAttr {
+	var attrs []hclAttr
+	depth := 0
+	for i, tok := range toks {
+		switch {
+		case tok.is(hclPunct, "{") || tok.is(hclPunct, "[") || tok.is(hclPunct, "("):
+			depth++
+		case tok.is(hclPunct, "}") || tok.is(hclPunct, "]") || tok.is(hclPunct, ")"):
+			if depth == 0 {
+				return attrs
+			}
+			depth--
+		case depth == 0 && (tok.kind == hclIdent || tok.kind == hclString && !tok.template) && i+2 < len(toks):
+			if i > 0 && !toks[i-1].is(hclPunct, "\n") && !toks[i-1].is(hclPunct, ",") && !toks[i-1].is(hclPunct, "{") {
+				continue
+			}
+			value := toks[i+2]
+			if !hclIsAssign(toks[i+1]) || value.kind != hclString || value.template {
+				continue
+			}
+			// The value has to be the whole of the expression, and not
+			// the start of one like "1.21" + suffix.
+			if i+3 < len(toks) && !toks[i+3].is(hclPunct, "\n") && !toks[i+3].is(hclPunct, ",") && !toks[i+3].is(hclPunct, "}") {
+				continue
+			}
+			attrs = append(attrs, hclAttr{tok.text, value})
+		}
+	}
+	return attrs
+}
+
+// hclIsAssign reports whether tok assigns a value to an attribute or an
+// object's key.
+func hclIsAssign(tok hclToken) bool {
+	return tok.is(hclPunct, "=") || tok.is(hclPunct, ":")
+}
@@ -0,0 +1,184 @@
+package ensure
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bazelGoSDKFuncs are the rules_go WORKSPACE macros that download a Go SDK and
+// take its version as the "version" keyword argument. The go_sdk.download tag
+// used in MODULE.bazel is matched by isBazelGoSDKCall because its name
+// depends on the file.
+var bazelGoSDKFuncs = map[string]bool{
+	"go_register_toolchains": true,
+	"go_download_sdk":        true,
+}
+
+// BazelUpdater updates the version argument of every rules_go call that
+// downloads a Go SDK.
+type BazelUpdater struct {
+	// UpdateChecksums makes the archive names and SHA-256 checksums in the
+	// calls' sdks argument be updated to the ones of the new release. Calls
+	// with an sdks argument are an error if it's not set because changing
+	// only their version would leave the checksums pointing at the old
+	// release.
+	UpdateChecksums bool
+}
+
+func (BazelUpdater) Name() string        { return "bazel" }
+func (BazelUpdater) Description() string { return "Bazel file" }
+
+func (BazelUpdater) Patterns() []string {
+	return []string{"MODULE.bazel", "WORKSPACE", "WORKSPACE.bazel"}
+}
+
+func (BazelUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	sdkCalls, err := findBazelGoSDKCalls(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	var pins []Pin
+	for _, call := range sdkCalls {
+		version := call.kwargs["version"][0]
+		pins = append(pins, starlarkStringPin(version))
+	}
+	return pins, nil
+}
+
+func (u BazelUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	sdkCalls, err := findBazelGoSDKCalls(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	var edits []Edit
+	for _, call := range sdkCalls {
+		version := call.kwargs["version"][0]
+		rel, goVers, ok := t.ResolveRelease(version.text)
+		if !ok || version.text == goVers {
+			continue
+		}
+		edits = append(edits, replaceStarlarkString(version, goVers))
+
+		sdks, ok := call.kwargs["sdks"]
+		if !ok {
+			continue
+		}
+		if !u.UpdateChecksums {
+			return nil, fmt.Errorf("unable to update Bazel file %#v: %s call has an sdks argument, but updating the SDK checksums wasn't enabled", fp, call.name)
+		}
+		sdkEdits, err := updateBazelSDKs(sdks, rel.Files)
+		if err != nil {
+			return nil, fmt.Errorf("unable to update Bazel file %#v: %s", fp, err)
+		}
+		edits = append(edits, sdkEdits...)
+	}
+	return edits, nil
+}
+
+// findBazelGoSDKCalls returns the calls in a Bazel file that download a Go SDK
+// and have a Go version string as their version argument.
+func findBazelGoSDKCalls(fp string, contents []byte) ([]starlarkCall, error) {
+	toks, err := tokenizeStarlark(contents)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Bazel file %#v: %s", fp, err)
+	}
+	calls := findStarlarkCalls(toks)
+
+	// The go_sdk module extension is usually, but not always, assigned to a
+	// variable named go_sdk.
+	extensionVars := map[string]bool{"go_sdk": true}
+	for i := 0; i+4 < len(toks); i++ {
+		if toks[i].kind == starlarkIdent && toks[i+1].is(starlarkPunct, "=") &&
+			toks[i+2].is(starlarkIdent, "use_extension") && toks[i+3].is(starlarkPunct, "(") &&
+			toks[i+4].kind == starlarkString {
+			if i+6 < len(toks) && toks[i+5].is(starlarkPunct, ",") && toks[i+6].is(starlarkString, "go_sdk") {
+				extensionVars[toks[i].text] = true
+			}
+		}
+	}
+
+	var sdkCalls []starlarkCall
+	for _, call := range calls {
+		if !isBazelGoSDKCall(call.name, extensionVars) {
+			continue
+		}
+		version := call.kwargs["version"]
+		if len(version) != 1 || version[0].kind != starlarkString || !toolGoVersionRe.MatchString(version[0].text) {
+			continue
+		}
+		sdkCalls = append(sdkCalls, call)
+	}
+	return sdkCalls, nil
+}
+
+func isBazelGoSDKCall(name string, extensionVars map[string]bool) bool {
+	if bazelGoSDKFuncs[name] {
+		return true
+	}
+	parts := strings.Split(name, ".")
+	return len(parts) == 2 && extensionVars[parts[0]] && parts[1] == "download"
+}
+
+// updateBazelSDKs returns the edits that point the entries of an sdks
+// dictionary, like
+//
+//	{"linux_amd64": ("go1.21.5.linux-amd64.tar.gz", "e2bc0b3e...")}
+//
+// at the archives in files.
+func updateBazelSDKs(sdks []starlarkToken, files []ReleaseFile) ([]Edit, error) {
+	if len(sdks) == 0 || !sdks[0].is(starlarkPunct, "{") {
+		return nil, fmt.Errorf("sdks argument is not a dictionary literal")
+	}
+	var edits []Edit
+	// Each entry is the tokens: platform : ( filename , sha256 ,? )
+	for i := 1; i < len(sdks); i++ {
+		if !(sdks[i].kind == starlarkString && i+5 < len(sdks) &&
+			sdks[i+1].is(starlarkPunct, ":") && sdks[i+2].is(starlarkPunct, "(") &&
+			sdks[i+3].kind == starlarkString && sdks[i+4].is(starlarkPunct, ",") &&
+			sdks[i+5].kind == starlarkString) {
+			continue
+		}
+		platform := sdks[i].text
+		f, ok := findBazelSDKFile(platform, files)
+		if !ok {
+			return nil, fmt.Errorf("no Go release archive found for the sdks platform %#v", platform)
+		}
+		edits = append(edits, replaceStarlarkString(sdks[i+3], f.Filename), replaceStarlarkString(sdks[i+5], f.SHA256))
+		i += 5
+	}
+	return edits, nil
+}
+
+// findBazelSDKFile returns the release archive for a rules_go platform name
+// like "linux_amd64".
+func findBazelSDKFile(platform string, files []ReleaseFile) (ReleaseFile, bool) {
+	parts := strings.SplitN(platform, "_", 2)
+	if len(parts) != 2 {
+		return ReleaseFile{}, false
+	}
+	goos, goarch := parts[0], parts[1]
+	if goarch == "arm" {
+		// The 32-bit ARM archives are for ARMv6 and up.
+		goarch = "armv6l"
+	}
+	for _, f := range files {
+		if f.Kind == "archive" && f.OS == goos && f.Arch == goarch {
+			return f, true
+		}
+	}
+	return ReleaseFile{}, false
+}
+
+// starlarkStringPin returns the pin of the Go version in the string literal
+// tok. Go versions don't have escapes in them, so the version is all of the
+// text before the closing quote.
+func starlarkStringPin(tok starlarkToken) Pin {
+	end := tok.end - len(tok.quote)
+	return Pin{tok.text, end - len(tok.text), end}
+}
+
+// replaceStarlarkString returns the edit that replaces the string literal tok
+// with s, keeping its quotes.
+func replaceStarlarkString(tok starlarkToken, s string) Edit {
+	return Edit{tok.start, tok.end, tok.quote + s + tok.quote}
+}
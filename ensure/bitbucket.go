@@ -0,0 +1,80 @@
+package ensure
+
+import (
+	"fmt"
+
+	"gopkg.in/jmhodges/yaml.v2"
+)
+
+// BitbucketUpdater updates every golang image used in a Bitbucket Pipelines
+// config. Images can be set globally, per step, or per service, and either as
+// a plain string or as a map with a "name" key.
+type BitbucketUpdater struct{}
+
+func (BitbucketUpdater) Name() string        { return "bitbucket" }
+func (BitbucketUpdater) Description() string { return "Bitbucket Pipelines config file" }
+func (BitbucketUpdater) Patterns() []string  { return []string{"bitbucket-pipelines.yml"} }
+
+func (BitbucketUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	var by yaml.MapSlice
+	err := yaml.Unmarshal(contents, &by)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse YAML Bitbucket Pipelines config file %#v: %s", fp, err)
+	}
+
+	lines := yamlLineNumbers(contents)
+	var pins []Pin
+	var walkErr error
+	walkMapSlicePaths(by, "", func(path string, obj yaml.MapSlice) {
+		_, image, err := findMapItem(obj, "image")
+		if err != nil {
+			walkErr = err
+			return
+		}
+		imagePath := yamlPath(path, "image")
+		if img, ok := image.(yaml.MapSlice); ok {
+			_, image, err = findMapItemAsString(img, "name")
+			if err != nil {
+				walkErr = err
+				return
+			}
+			imagePath = yamlPath(imagePath, "name")
+		}
+		ref, ok := image.(string)
+		if !ok || walkErr != nil {
+			return
+		}
+		start, end, ok := golangImageRefVersion(ref)
+		if !ok {
+			return
+		}
+		refStart, refEnd, ok := yamlScalarAt(contents, lines, imagePath)
+		if !ok && yamlInAlias(contents, lines, imagePath) {
+			// Aliased steps, like "- step: *build", are the same as
+			// their anchors, which are found by their own paths.
+			return
+		}
+		if !ok || string(contents[refStart:refEnd]) != ref {
+			walkErr = fmt.Errorf("unable to find image %#v", ref)
+			return
+		}
+		// Images that are aliases are found at their anchor, which can
+		// be used more than once.
+		p := Pin{ref[start:end], refStart + start, refStart + end}
+		if !containsPin(pins, p) {
+			pins = append(pins, p)
+		}
+	})
+	if walkErr != nil {
+		return nil, fmt.Errorf("unable to parse YAML Bitbucket Pipelines config file %#v: %s", fp, walkErr)
+	}
+	return pins, nil
+}
+
+func (u BitbucketUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, golangTagPinVersion), nil
+}
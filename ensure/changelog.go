@@ -0,0 +1,199 @@
+package ensure
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// ReleaseHistoryURL is the page of the Go release history, whose entries
+// say what each release fixed.
+const ReleaseHistoryURL = "https://go.dev/doc/devel/release"
+
+// DefaultChangelogTemplate is the template of the changelog unless it's
+// overridden. It's executed with a Changelog.
+const DefaultChangelogTemplate = `### Go releases since {{if .OldVersions}}{{join .OldVersions ", "}}{{else}}the last update{{end}}
+{{range .Releases}}
+- [Go {{.Version}}]({{.URL}}){{if .Date}} ({{.Date}}){{end}}{{if .Security}} **security release**{{end}}{{if .Summary}}: {{.Summary}}{{end}}{{end}}
+{{with .Vulns}}
+### Vulnerabilities fixed
+{{range .}}
+- [{{.ID}}]({{.URL}}){{with .Aliases}} ({{join . ", "}}){{end}}, fixed in Go {{.Fixed}}: {{.Summary}}{{end}}
+{{end}}`
+
+// ReleaseNote is a release's entry in the Go release history.
+type ReleaseNote struct {
+	// Version is the release's name, like "go1.22.3".
+	Version string
+	// Date is when it was released, like "2024-05-07".
+	Date string
+	// Security is whether the release includes security fixes.
+	Security bool
+	// Summary is the entry's text saying what the release fixed.
+	Summary string
+}
+
+// ReleaseNotesSource returns the entries of the Go release history. It's
+// GetReleaseNotes except in tests and for people running offline.
+type ReleaseNotesSource func(c *HTTPClient) ([]ReleaseNote, error)
+
+// GetReleaseNotes returns the entries of the Go release history from
+// ReleaseHistoryURL.
+func GetReleaseNotes(c *HTTPClient) ([]ReleaseNote, error) {
+	b, err := c.Get(ReleaseHistoryURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the Go release history: %s", err)
+	}
+	notes := ParseReleaseNotes(b)
+	if len(notes) == 0 {
+		return nil, fmt.Errorf("no releases found in the Go release history")
+	}
+	return notes, nil
+}
+
+var (
+	// releaseNoteRe matches the start of an entry in the release history,
+	// which is either an <h2> for a major release or a <p> for a minor one.
+	releaseNoteRe    = regexp.MustCompile(`<(?:h2|p)\s[^>]*\bid="(go\d+(?:\.\d+)*)"[^>]*>`)
+	releaseNoteEndRe = regexp.MustCompile(`<h[1-6][\s>]`)
+	htmlTagRe        = regexp.MustCompile(`<[^>]*>`)
+	releasedDateRe   = regexp.MustCompile(`^\S+ \(released (\d{4})[-/](\d{2})[-/](\d{2})\)\s*`)
+)
+
+// ParseReleaseNotes parses the HTML of the Go release history page.
+func ParseReleaseNotes(page []byte) []ReleaseNote {
+	s := string(page)
+	locs := releaseNoteRe.FindAllStringSubmatchIndex(s, -1)
+	var notes []ReleaseNote
+	for i, loc := range locs {
+		end := len(s)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		// Major releases' entries are followed by the heading of their minor
+		// revisions.
+		if m := releaseNoteEndRe.FindStringIndex(s[loc[1]:end]); m != nil {
+			end = loc[1] + m[0]
+		}
+		text := htmlTagRe.ReplaceAllString(s[loc[1]:end], " ")
+		text = strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+		note := ReleaseNote{Version: s[loc[2]:loc[3]]}
+		if m := releasedDateRe.FindStringSubmatch(text); m != nil {
+			note.Date = m[1] + "-" + m[2] + "-" + m[3]
+			text = text[len(m[0]):]
+		}
+		// The milestone link at the end of every minor release's entry
+		// doesn't say anything about the release.
+		if i := strings.Index(text, " See the "); i != -1 {
+			text = text[:i]
+		}
+		note.Summary = text
+		note.Security = strings.Contains(strings.ToLower(text), "security fix")
+		notes = append(notes, note)
+	}
+	return notes
+}
+
+// ChangelogRelease is a release in a Changelog.
+type ChangelogRelease struct {
+	// Version is the release's version without the "go", like "1.22.3".
+	Version string
+	// URL is the release's entry in the Go release history.
+	URL      string
+	Date     string
+	Security bool
+	Summary  string
+}
+
+// ChangelogVuln is a vulnerability in Go that an update fixes.
+type ChangelogVuln struct {
+	// ID is the Go vulnerability database's ID, like "GO-2024-2887".
+	ID string
+	// Aliases are its other IDs, like CVEs.
+	Aliases []string
+	URL     string
+	Summary string
+	// Fixed is the first release, like "1.21.11", that fixes it for the
+	// versions being updated from.
+	Fixed string
+}
+
+// Changelog is the releases of Go that files are being updated past.
+type Changelog struct {
+	// GoVersion is the version files are being updated to, like "1.22.3".
+	GoVersion string
+	// OldVersions are the versions files are being updated from.
+	OldVersions []string
+	// Releases are the stable releases newer than the oldest of OldVersions,
+	// up to and including GoVersion, newest first.
+	Releases []ChangelogRelease
+	// Security is whether any of the releases include security fixes.
+	Security bool
+	// Vulns are the known vulnerabilities that affect any of OldVersions but
+	// not GoVersion.
+	Vulns []ChangelogVuln
+}
+
+// NewChangelog returns the changelog of updating from oldVersions to goVers.
+// The releases in between come from releases, which is newest first like
+// GetReleases returns, and are described by notes, which can be empty if the
+// release history isn't available. The vulnerabilities fixed come from db,
+// which can be nil if it hasn't been loaded.
+func NewChangelog(releases []Release, notes []ReleaseNote, db *VulnDB, oldVersions []string, goVers string) Changelog {
+	c := Changelog{GoVersion: goVers, OldVersions: oldVersions}
+	fixedIn := make(map[string]bool)
+	for _, fv := range db.Fixed(oldVersions, goVers, releases) {
+		c.Vulns = append(c.Vulns, ChangelogVuln{
+			ID:      fv.ID,
+			Aliases: fv.Aliases,
+			URL:     fv.URL(),
+			Summary: fv.Summary,
+			Fixed:   fv.Fixed,
+		})
+		fixedIn[fv.Fixed] = true
+	}
+	newest, ok := parseGoVersion(goVers)
+	if !ok {
+		return c
+	}
+	oldest, haveOldest := goVersion{}, false
+	for _, v := range oldVersions {
+		old, ok := parseGoVersion(v)
+		if ok && (!haveOldest || old.compare(oldest) < 0) {
+			oldest, haveOldest = old, true
+		}
+	}
+	byVersion := make(map[string]ReleaseNote)
+	for _, n := range notes {
+		byVersion[n.Version] = n
+	}
+	for _, r := range releases {
+		v, ok := parseGoVersion(r.Version)
+		if !ok || !r.Stable || v.compare(newest) > 0 {
+			continue
+		}
+		// Without any old versions to go from, only the new one is listed.
+		if haveOldest && v.compare(oldest) <= 0 || !haveOldest && v.compare(newest) != 0 {
+			continue
+		}
+		n := byVersion[r.Version]
+		semver, _ := vulnSemver(r.Version)
+		security := n.Security || fixedIn[semver]
+		c.Releases = append(c.Releases, ChangelogRelease{
+			Version:  strings.TrimPrefix(r.Version, "go"),
+			URL:      ReleaseHistoryURL + "#" + r.Version,
+			Date:     n.Date,
+			Security: security,
+			Summary:  n.Summary,
+		})
+		c.Security = c.Security || security
+	}
+	return c
+}
+
+// Markdown executes the text/template tmpl, like DefaultChangelogTemplate,
+// with the changelog.
+func (c Changelog) Markdown(tmpl string) (string, error) {
+	return ExecuteTemplate("changelog", tmpl, c)
+}
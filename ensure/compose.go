@@ -0,0 +1,159 @@
+package ensure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/jmhodges/yaml.v2"
+)
+
+// ComposeUpdater updates the golang images and the Go version build args of
+// the services in Docker Compose files, like
+//
+//	services:
+//	  app:
+//	    image: golang:1.21
+//	  tools:
+//	    build:
+//	      args:
+//	        GO_VERSION: 1.21.5
+//
+// The images' tags are read the way DockerfileUpdater reads them, and the
+// args are the same GOLANG_VERSION and GO_VERSION variables that it updates
+// the ARG instructions of, so the args passed to a Dockerfile are kept in step
+// with its own defaults. Only the versions themselves are changed, leaving the
+// rest of the file's layout and comments alone.
+type ComposeUpdater struct{}
+
+func (ComposeUpdater) Name() string        { return "compose" }
+func (ComposeUpdater) Description() string { return "Compose file" }
+
+// Patterns match the file names that docker compose looks for, along with
+// their override files, like docker-compose.override.yml and compose.ci.yaml.
+func (ComposeUpdater) Patterns() []string {
+	return []string{
+		"**/compose.yml", "**/compose.yaml", "**/compose.*.yml", "**/compose.*.yaml",
+		"**/docker-compose.yml", "**/docker-compose.yaml", "**/docker-compose.*.yml", "**/docker-compose.*.yaml",
+	}
+}
+
+func (ComposeUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	var doc yaml.MapSlice
+	err := yaml.Unmarshal(contents, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse YAML Compose file %#v: %s", fp, err)
+	}
+	_, services, err := findMapItemAsMapSlice(doc, "services")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse YAML Compose file %#v: %s", fp, err)
+	}
+
+	lines := yamlLineNumbers(contents)
+	var pins []Pin
+	for _, svc := range services {
+		name, _ := svc.Key.(string)
+		conf, ok := svc.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		svcPath := yamlPath("services", name)
+		for _, item := range conf {
+			switch item.Key {
+			case "image":
+				ref, ok := item.Value.(string)
+				if !ok {
+					continue
+				}
+				vStart, vEnd, ok := golangImageRefVersion(ref)
+				if !ok {
+					continue
+				}
+				// Images that are aliases, like "image: *go", are found
+				// at their anchor, which can be used more than once.
+				start, end, ok := yamlScalarAt(contents, lines, yamlPath(svcPath, "image"))
+				p := Pin{ref[vStart:vEnd], start + vStart, start + vEnd}
+				if !ok || string(contents[start:end]) != ref || containsPin(pins, p) {
+					continue
+				}
+				pins = append(pins, p)
+			case "build":
+				build, ok := item.Value.(yaml.MapSlice)
+				if !ok {
+					continue
+				}
+				_, args, err := findMapItem(build, "args")
+				if err != nil {
+					return nil, fmt.Errorf("unable to parse YAML Compose file %#v: %s", fp, err)
+				}
+				pins = append(pins, composeArgPins(contents, lines, yamlPath(svcPath, "build.args"), args)...)
+			}
+		}
+	}
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].Start < pins[j].Start })
+	return pins, nil
+}
+
+func containsPin(pins []Pin, p Pin) bool {
+	for _, q := range pins {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// composeArgPins returns the pins of the Go version variables in the build
+// args at path, which are either a map of names to values or a list of
+// "NAME=value" strings.
+func composeArgPins(contents []byte, lines map[string]int, path string, args interface{}) []Pin {
+	var pins []Pin
+	switch args := args.(type) {
+	case yaml.MapSlice:
+		for _, arg := range args {
+			name, _ := arg.Key.(string)
+			if !goVersionVars[name] || arg.Value == nil {
+				continue
+			}
+			// Versions like 1.21 are decoded as numbers, so the value is
+			// read from the source instead.
+			start, end, ok := yamlScalarAt(contents, lines, yamlPath(path, name))
+			if !ok {
+				continue
+			}
+			if p, ok := goVersionVarPin(string(contents[start:end]), start); ok {
+				pins = append(pins, p)
+			}
+		}
+	case []interface{}:
+		for i, arg := range args {
+			s, ok := arg.(string)
+			if !ok {
+				continue
+			}
+			eq := strings.IndexByte(s, '=')
+			if eq == -1 || !goVersionVars[s[:eq]] {
+				continue
+			}
+			start, end, ok := yamlScalarAt(contents, lines, fmt.Sprintf("%s[%d]", path, i))
+			if !ok || string(contents[start:end]) != s {
+				continue
+			}
+			if p, ok := goVersionVarPin(s[eq+1:], start+eq+1); ok {
+				pins = append(pins, p)
+			}
+		}
+	}
+	return pins
+}
+
+func (u ComposeUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	quote := quoteYAMLNumber(contents)
+	return pinEdits(pins, t, func(p Pin, goVers string) string {
+		return quote(p, golangTagPinVersion(p, goVers))
+	}), nil
+}
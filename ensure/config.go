@@ -0,0 +1,254 @@
+package ensure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/jmhodges/yaml.v2"
+)
+
+// DefaultConfigFile is where a repository's ensure-latest-go config lives
+// unless the config input says otherwise.
+const DefaultConfigFile = ".github/ensure-latest-go.yml"
+
+// Config is the repository's ensure-latest-go config file. It lets different
+// paths and file types in a repo be given different policies for how their Go
+// versions are updated. For example:
+//
+//	rules:
+//	  - paths: ["services/**"]
+//	    exclude: ["services/legacy/**"]
+//	    types: [dockerfile]
+//	    policy: patch
+//	    precision: minor
+//
+// A file uses the last rule that matches it, so more specific rules go at
+// the bottom. Files that match no rule use the default rule.
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+
+	// types are the names of the file types the config was validated
+	// against.
+	types []string
+}
+
+// Rule sets the version policy of the files it matches.
+type Rule struct {
+	// Paths are the glob patterns, relative to the repo's root, of the files
+	// the rule applies to. Like the inputs, patterns can be negated with a
+	// leading "!". Defaults to all files.
+	Paths []string `yaml:"paths,omitempty"`
+	// Exclude are the glob patterns of files the rule doesn't apply to even
+	// if they match Paths.
+	Exclude []string `yaml:"exclude,omitempty"`
+	// Types are the types of files the rule applies to. Defaults to all of
+	// them.
+	Types []string `yaml:"types,omitempty"`
+	// Policy is one of the policy constants. Defaults to "latest".
+	Policy string `yaml:"policy,omitempty"`
+	// AllowDowngrade lets pins newer than the version picked by the policy,
+	// like release candidates, be changed to it. Defaults to false.
+	AllowDowngrade *bool `yaml:"allow_downgrade,omitempty"`
+	// Precision is one of the precision constants. Defaults to "full".
+	Precision string `yaml:"precision,omitempty"`
+}
+
+var (
+	validPolicies   = []string{PolicyLatest, PolicyPatch, PolicySecurity, PolicySkip}
+	validPrecisions = []string{PrecisionFull, PrecisionMinor, PrecisionPreserve}
+)
+
+// defaultRule is used for files that don't match any of a config's rules, and
+// fills in the unset fields of the rules that do match.
+func defaultRule(types []string) Rule {
+	allowDowngrade := false
+	return Rule{
+		Paths:          []string{"**"},
+		Types:          types,
+		Policy:         PolicyLatest,
+		AllowDowngrade: &allowDowngrade,
+		Precision:      PrecisionFull,
+	}
+}
+
+// LoadConfig reads and validates the config file at fp. types are the names
+// of the file types that rules may name. A missing file is not an error and
+// gives an empty config.
+func LoadConfig(fp string, types []string) (*Config, error) {
+	b, err := ioutil.ReadFile(fp)
+	if os.IsNotExist(err) {
+		return &Config{types: types}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file %#v: %s", fp, err)
+	}
+	cfg, err := ParseConfig(b, types)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %#v: %s", fp, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses a config file strictly. Unknown fields, values of the
+// wrong type, and unknown policies, precisions, file types, and malformed
+// glob patterns are all errors, and the errors include the line they're on.
+func ParseConfig(b []byte, types []string) (*Config, error) {
+	cfg := &Config{types: types}
+	err := yaml.UnmarshalStrict(b, cfg)
+	if err != nil {
+		return nil, err
+	}
+	lines := yamlLineNumbers(b)
+	errorf := func(path string, format string, args ...interface{}) error {
+		msg := fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...))
+		// Fall back to the line of the enclosing rule for values that
+		// yamlLineNumbers couldn't find.
+		for p := path; p != ""; {
+			if line, ok := lines[p]; ok {
+				return fmt.Errorf("line %d: %s", line, msg)
+			}
+			i := strings.LastIndexAny(p, ".[")
+			if i == -1 {
+				break
+			}
+			p = p[:i]
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	knownTypes := make(map[string]bool)
+	for _, name := range types {
+		knownTypes[name] = true
+	}
+	for i, rule := range cfg.Rules {
+		rulePath := fmt.Sprintf("rules[%d]", i)
+		for j, pattern := range rule.Paths {
+			if err := validateGlob(strings.TrimPrefix(pattern, "!")); err != nil {
+				return nil, errorf(fmt.Sprintf("%s.paths[%d]", rulePath, j), "%s", err)
+			}
+		}
+		for j, pattern := range rule.Exclude {
+			if err := validateGlob(pattern); err != nil {
+				return nil, errorf(fmt.Sprintf("%s.exclude[%d]", rulePath, j), "%s", err)
+			}
+		}
+		for j, typ := range rule.Types {
+			if !knownTypes[typ] {
+				return nil, errorf(fmt.Sprintf("%s.types[%d]", rulePath, j), "unknown file type %#v (must be one of %s)", typ, strings.Join(types, ", "))
+			}
+		}
+		if rule.Policy != "" && !contains(validPolicies, rule.Policy) {
+			return nil, errorf(rulePath+".policy", "unknown policy %#v (must be one of %s)", rule.Policy, strings.Join(validPolicies, ", "))
+		}
+		if rule.Precision != "" && !contains(validPrecisions, rule.Precision) {
+			return nil, errorf(rulePath+".precision", "unknown precision %#v (must be one of %s)", rule.Precision, strings.Join(validPrecisions, ", "))
+		}
+	}
+	return cfg, nil
+}
+
+func contains(strs []string, s string) bool {
+	for _, x := range strs {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Effective returns the config with the defaults filled into every rule and
+// the default rule listed first, so that it's clear what each file will get.
+func (c *Config) Effective() *Config {
+	def := defaultRule(c.types)
+	out := &Config{Rules: []Rule{def}, types: c.types}
+	for _, rule := range c.Rules {
+		out.Rules = append(out.Rules, rule.withDefaults(def))
+	}
+	return out
+}
+
+func (r Rule) withDefaults(def Rule) Rule {
+	if len(r.Paths) == 0 {
+		r.Paths = def.Paths
+	}
+	if len(r.Types) == 0 {
+		r.Types = def.Types
+	}
+	if r.Policy == "" {
+		r.Policy = def.Policy
+	}
+	if r.AllowDowngrade == nil {
+		r.AllowDowngrade = def.AllowDowngrade
+	}
+	if r.Precision == "" {
+		r.Precision = def.Precision
+	}
+	return r
+}
+
+func (r Rule) matches(fileType, relPath string) bool {
+	// Rules in configs that weren't loaded with the names of the file types
+	// can have no types even with their defaults filled in.
+	if len(r.Types) != 0 && !contains(r.Types, fileType) {
+		return false
+	}
+	for _, pattern := range r.Exclude {
+		if matchGlob(pattern, relPath) {
+			return false
+		}
+	}
+	matched, _ := GlobList(r.Paths).Match(relPath)
+	return matched
+}
+
+// RuleFor returns the rule, with its defaults filled in, that applies to the
+// file at relPath, a slash-separated path relative to the repo's root.
+func (c *Config) RuleFor(fileType, relPath string) Rule {
+	eff := c.Effective()
+	for i := len(eff.Rules) - 1; i >= 0; i-- {
+		if eff.Rules[i].matches(fileType, relPath) {
+			return eff.Rules[i]
+		}
+	}
+	return eff.Rules[0]
+}
+
+// String returns the config as YAML.
+func (c *Config) String() string {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		// Our own config struct can always be marshaled.
+		panic(err)
+	}
+	return string(b)
+}
+
+// Targets picks the Target for each file using the repo's config.
+type Targets struct {
+	Config *Config
+	// Root is the absolute path of the repo's top-level directory.
+	Root string
+	// Releases are the stable releases of Go, newest first.
+	Releases []Release
+	// Vulns are the known vulnerabilities in Go, if they've been loaded.
+	Vulns *VulnDB
+}
+
+// ForFile returns the Target for the file at the absolute path fp.
+func (ts Targets) ForFile(fileType, fp string) Target {
+	relPath, err := filepath.Rel(ts.Root, fp)
+	if err != nil {
+		relPath = fp
+	}
+	rule := ts.Config.RuleFor(fileType, filepath.ToSlash(relPath))
+	return Target{
+		Releases:       ts.Releases,
+		Policy:         rule.Policy,
+		Precision:      rule.Precision,
+		AllowDowngrade: *rule.AllowDowngrade,
+		Vulns:          ts.Vulns,
+	}
+}
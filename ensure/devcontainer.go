@@ -0,0 +1,146 @@
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// devcontainerGoFeatures are the IDs, without their tags, of the devcontainer
+// features that install Go and take a "version" option.
+var devcontainerGoFeatures = map[string]bool{
+	"ghcr.io/devcontainers/features/go": true,
+	"go":                                true,
+	"golang":                            true,
+}
+
+// devcontainerGoImages are the devcontainer images, without their tags, that
+// have a Go version in their tags.
+var devcontainerGoImages = map[string]bool{
+	"mcr.microsoft.com/devcontainers/go":        true,
+	"mcr.microsoft.com/vscode/devcontainers/go": true,
+}
+
+// devcontainerGoImageTagRe matches the tags of the devcontainer Go images. They
+// look like "1-1.21-bookworm" where the leading "1-" is the version of the
+// image itself and is optional.
+var devcontainerGoImageTagRe = regexp.MustCompile(`^(\d+-)?(\d+\.\d+(?:\.\d+)?)(-.*)?$`)
+
+// DevcontainerUpdater updates the version option of the Go devcontainer
+// feature and the tag of a Go devcontainer image. Only the version strings are
+// changed. Comments, trailing commas, and the rest of the file are left
+// exactly as they were.
+type DevcontainerUpdater struct{}
+
+func (DevcontainerUpdater) Name() string        { return "devcontainer" }
+func (DevcontainerUpdater) Description() string { return "devcontainer.json file" }
+
+func (DevcontainerUpdater) Patterns() []string {
+	return []string{".devcontainer/devcontainer.json", ".devcontainer/*/devcontainer.json"}
+}
+
+func (DevcontainerUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	root, err := parseJSONC(contents)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse devcontainer.json file %#v: %s", fp, err)
+	}
+	if root.kind != jsoncObject {
+		return nil, fmt.Errorf("unable to parse devcontainer.json file %#v: top-level value is not an object", fp)
+	}
+
+	var pins []Pin
+	if features := root.member("features"); features != nil && features.kind == jsoncObject {
+		for _, m := range features.members {
+			id := m.key
+			if i := strings.LastIndex(id, ":"); i != -1 && !strings.Contains(id[i:], "/") {
+				id = id[:i]
+			}
+			if !devcontainerGoFeatures[id] {
+				continue
+			}
+			// Features can be given their options or, as a shorthand, just
+			// their version.
+			version := m.value
+			if version.kind == jsoncObject {
+				version = version.member("version")
+			}
+			if version == nil || version.kind != jsoncString || !toolGoVersionRe.MatchString(version.str) {
+				continue
+			}
+			// The string's offsets include its quotes.
+			pins = append(pins, Pin{version.str, version.start + 1, version.end - 1})
+		}
+	}
+
+	if image := root.member("image"); image != nil && image.kind == jsoncString {
+		if start, end, ok := devcontainerImageVersion(image.str); ok {
+			// Image names don't have escapes in them, so the offsets in
+			// the string are the offsets in the file after the quote.
+			offset := image.start + 1
+			pins = append(pins, Pin{image.str[start:end], offset + start, offset + end})
+		}
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].Start < pins[j].Start
+	})
+	return pins, nil
+}
+
+func (u DevcontainerUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, func(p Pin, goVers string) string {
+		switch image := devcontainerImageName(contents, p); {
+		case image == "golang":
+			return golangTagPinVersion(p, goVers)
+		case devcontainerGoImages[image] && strings.Count(p.Version, ".") == 1:
+			// The Go devcontainer images are only tagged with the major
+			// and minor versions of Go, so don't add a patch version where
+			// there wasn't one.
+			return goMinorVersion(goVers)
+		}
+		return goVers
+	}), nil
+}
+
+// devcontainerImageVersion returns the offsets of the Go version in a
+// devcontainer image reference, and false if it doesn't have one. An untagged
+// golang image gives the empty offsets at its end.
+func devcontainerImageVersion(image string) (int, int, bool) {
+	if start, end, ok := golangImageRefVersion(image); ok {
+		return start, end, true
+	}
+	i := strings.LastIndex(image, ":")
+	if i == -1 || !devcontainerGoImages[image[:i]] {
+		return 0, 0, false
+	}
+	m := devcontainerGoImageTagRe.FindStringSubmatchIndex(image[i+1:])
+	if m == nil {
+		return 0, 0, false
+	}
+	return i + 1 + m[4], i + 1 + m[5], true
+}
+
+// devcontainerImageName returns the name, without its tag, of the image that
+// the pin p is in, or the empty string if p is a feature's version.
+func devcontainerImageName(contents []byte, p Pin) string {
+	start := bytes.LastIndexByte(contents[:p.Start], '"') + 1
+	ref := string(contents[start:p.Start])
+	if i := strings.LastIndex(ref, ":"); i != -1 {
+		return ref[:i]
+	}
+	return ref
+}
+
+// goMinorVersion returns the major and minor parts of the given Go version.
+func goMinorVersion(goVers string) string {
+	parts := strings.SplitN(goVers, ".", 3)
+	if len(parts) < 2 {
+		return goVers
+	}
+	return parts[0] + "." + parts[1]
+}
@@ -0,0 +1,226 @@
+package ensure
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DockerfileUpdater updates the tag of the golang image in a Dockerfile's
+// first FROM instruction and in the --from flags of its COPY and RUN --mount instructions,
+// the version and checksums of Go in Dockerfiles that install it from a
+// release archive, and the versions of GOTOOLCHAIN settings.
+type DockerfileUpdater struct{}
+
+func (DockerfileUpdater) Name() string        { return "dockerfile" }
+func (DockerfileUpdater) Description() string { return "Dockerfile" }
+
+// Patterns match the usual names of Dockerfiles and Containerfiles. BuildKit
+// reads a Dockerfile's own ignore file from next to it as
+// Dockerfile.dockerignore, which isn't a Dockerfile.
+func (DockerfileUpdater) Patterns() []string {
+	return []string{"**/Dockerfile", "**/Dockerfile.*", "**/*.Dockerfile", "**/Containerfile", "!**/*.dockerignore"}
+}
+
+func (DockerfileUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	insts := parseDockerfile(contents)
+	pins := append(dockerTarballPins(contents, insts), dockerFromFlagPins(insts)...)
+	pins = append(pins, dockerToolchainPins(contents, insts)...)
+	if p, ok := dockerFromPin(insts); ok {
+		pins = append(pins, p)
+	}
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].Start < pins[j].Start })
+	return pins, nil
+}
+
+// dockerFromPin returns the pin of the golang image's tag in the first FROM
+// instruction of a Dockerfile, if it's from the golang image.
+func dockerFromPin(insts []dockerInstruction) (Pin, bool) {
+	for _, inst := range insts {
+		if inst.cmd != "from" {
+			continue
+		}
+		flags := dockerFlags(inst.words)
+		if len(flags) == len(inst.words) {
+			return Pin{}, false
+		}
+		image := inst.words[len(flags)]
+		// Comments only start at the beginning of lines, but a "#" right
+		// after the image has always been taken to start one.
+		if i := strings.IndexByte(image.text, '#'); i != -1 {
+			image.text = image.text[:i]
+		}
+		return golangImagePin(image.text, image.start)
+	}
+	return Pin{}, false
+}
+
+// golangImagePin returns the pin of the Go version in image, a reference like
+// "golang:1.21.5-alpine" that starts at the byte offset start, and false if
+// it's not to the golang image.
+func golangImagePin(image string, start int) (Pin, bool) {
+	vStart, vEnd, ok := golangImageRefVersion(image)
+	if !ok {
+		return Pin{}, false
+	}
+	return Pin{image[vStart:vEnd], start + vStart, start + vEnd}, true
+}
+
+// dockerFromFlagPins returns the pins of the golang images in the --from flags
+// of COPY instructions and the --mount flags of RUN instructions, like
+//
+//	COPY --from=golang:1.21 /usr/local/go /usr/local/go
+//	RUN --mount=type=bind,from=golang:1.21,source=/usr/local/go,target=/go
+//
+// An untagged --from=golang is left alone when there's a build stage named
+// golang since it refers to the stage and not the image.
+func dockerFromFlagPins(insts []dockerInstruction) []Pin {
+	golangStage := false
+	for _, inst := range insts {
+		n := len(inst.words)
+		if inst.cmd == "from" && n >= 3 && strings.EqualFold(inst.words[n-2].text, "as") && strings.EqualFold(inst.words[n-1].text, "golang") {
+			golangStage = true
+		}
+	}
+	var pins []Pin
+	for _, inst := range insts {
+		if inst.cmd != "copy" && inst.cmd != "run" {
+			continue
+		}
+		for _, flag := range dockerFlags(inst.words) {
+			eq := strings.IndexByte(flag.text, '=')
+			if eq == -1 {
+				continue
+			}
+			name, value, valueStart := strings.ToLower(flag.text[:eq]), flag.text[eq+1:], flag.start+eq+1
+			var images []dockerWord
+			switch {
+			case name == "--from" && inst.cmd == "copy":
+				images = append(images, dockerWord{value, valueStart, valueStart + len(value)})
+			case name == "--mount" && inst.cmd == "run":
+				// The mount's options are comma-separated, and the whole
+				// of them can be quoted.
+				quoted := strings.Trim(value, `"'`)
+				offset := valueStart + strings.Index(value, quoted)
+				for _, opt := range strings.Split(quoted, ",") {
+					if strings.HasPrefix(strings.ToLower(opt), "from=") {
+						images = append(images, dockerWord{opt[len("from="):], offset + len("from="), offset + len(opt)})
+					}
+					offset += len(opt) + 1
+				}
+			}
+			for _, image := range images {
+				if image.text == "golang" && golangStage {
+					continue
+				}
+				if p, ok := golangImagePin(image.text, image.start); ok {
+					pins = append(pins, p)
+				}
+			}
+		}
+	}
+	return pins
+}
+
+// ResolvePin resolves the pins of release archives and GOTOOLCHAIN settings to
+// the full versions they're updated to.
+func (DockerfileUpdater) ResolvePin(contents []byte, p Pin, t Target) (string, bool) {
+	if containsPin(dockerFullVersionPins(contents, parseDockerfile(contents)), p) {
+		return resolveFullVersion(p.Version, t)
+	}
+	return t.Resolve(p.Version)
+}
+
+// dockerFullVersionPins returns the pins that are always updated to the full
+// version of a release. Archives are only named by their releases' full
+// versions, and their version variables have to name the same release, and
+// the go command only downloads toolchains by their full names, like
+// go1.21.0.
+func dockerFullVersionPins(contents []byte, insts []dockerInstruction) []Pin {
+	return append(dockerTarballPins(contents, insts), dockerToolchainPins(contents, insts)...)
+}
+
+// dockerToolchainPins returns the pins of the GOTOOLCHAIN settings in the
+// instructions, insts, of a Dockerfile, leaving out the ones in comments.
+func dockerToolchainPins(contents []byte, insts []dockerInstruction) []Pin {
+	var pins []Pin
+	lines := dockerCodeLines(contents, insts)
+	for _, p := range goToolchainPins(contents) {
+		for _, l := range lines {
+			if l.start <= p.Start && p.End <= l.end {
+				pins = append(pins, p)
+				break
+			}
+		}
+	}
+	return pins
+}
+
+func (u DockerfileUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := dockerChecksumEdits(fp, contents, parseDockerfile(contents), pins, t)
+	if err != nil {
+		return nil, err
+	}
+	full := dockerFullVersionPins(contents, parseDockerfile(contents))
+	edits := append(pinEdits(withoutPins(pins, full), t, golangTagPinVersion), fullVersionEdits(full, t)...)
+	return append(edits, checksums...), nil
+}
+
+var dockerTagRe = regexp.MustCompile(`^:\d+\.\d+(\.\d+)?-`)
+
+// golangTagVersion returns the offsets in s of the Go version in the tag,
+// s[nameEnd:tagEnd], of a golang image. The tag includes its leading colon, if
+// any. Tags like ":1.13.1-alpine" have their variant left out of the version,
+// and the whole of other tags is treated as the version. Untagged images give
+// the empty offsets at the end of their name.
+func golangTagVersion(s string, nameEnd, tagEnd int) (int, int) {
+	tag := s[nameEnd:tagEnd]
+	switch {
+	case dockerTagRe.MatchString(tag):
+		return nameEnd + 1, nameEnd + strings.IndexByte(tag, '-')
+	case tag != "":
+		return nameEnd + 1, tagEnd
+	}
+	return nameEnd, nameEnd
+}
+
+// golangTagPinVersion adds the colon that the new versions of untagged golang
+// image pins need to become their tags.
+func golangTagPinVersion(p Pin, goVers string) string {
+	if p.Version == "" {
+		return ":" + goVers
+	}
+	return goVers
+}
+
+var golangImageRefRe = regexp.MustCompile(`^golang(\:[\w-.]+)?$`)
+
+// golangImageRefVersion returns the offsets of the Go version in a bare image
+// reference like "golang:1.13.1-alpine" as used in CI config files, and false
+// if the reference isn't to the golang image.
+func golangImageRefVersion(image string) (int, int, bool) {
+	if !golangImageRefRe.MatchString(image) {
+		return 0, 0, false
+	}
+	start, end := golangTagVersion(image, len("golang"), len(image))
+	return start, end, true
+}
+
+// updateGolangImageRef returns the updated version of a bare image reference
+// like "golang:1.13.1-alpine". The boolean is false if the reference isn't to
+// the golang image or shouldn't be changed.
+func updateGolangImageRef(image string, t Target) (string, bool) {
+	start, end, ok := golangImageRefVersion(image)
+	if !ok {
+		return image, false
+	}
+	edits := pinEdits([]Pin{{image[start:end], start, end}}, t, golangTagPinVersion)
+	if len(edits) == 0 {
+		return image, false
+	}
+	return string(ApplyEdits([]byte(image), edits)), true
+}
@@ -0,0 +1,211 @@
+package ensure
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// dockerInstruction is an instruction in a Dockerfile, like a FROM or a RUN,
+// with its line continuations joined.
+type dockerInstruction struct {
+	// cmd is the instruction's keyword in lowercase, like "from".
+	cmd string
+	// words are the instruction's arguments split on whitespace. The escape
+	// characters of line continuations, the comment lines between them, and
+	// the bodies of heredocs aren't part of any word.
+	words []dockerWord
+	// start and end are the byte offsets of the whole instruction in the
+	// Dockerfile, up to the end of its last line, or of its last heredoc's
+	// terminator, without the line ending.
+	start, end int
+}
+
+// dockerWord is a whitespace-separated word of a Dockerfile instruction and
+// its byte offsets in the Dockerfile.
+type dockerWord struct {
+	text       string
+	start, end int
+}
+
+// dockerLine is a line of a Dockerfile. end is where its contents end, before
+// the "\n" or "\r\n".
+type dockerLine struct {
+	start, end int
+}
+
+var (
+	// dockerDirectiveRe matches a parser directive like "# escape=`".
+	dockerDirectiveRe = regexp.MustCompile(`^#[ \t]*([a-zA-Z][a-zA-Z0-9_]*)[ \t]*=[ \t]*(\S+)[ \t]*$`)
+	// dockerHeredocRe matches the start of a heredoc, like <<EOF, <<-EOF, or
+	// <<"EOF", in a RUN, COPY, or ADD instruction.
+	dockerHeredocRe = regexp.MustCompile(`<<(-?)(["']?)([A-Za-z_][A-Za-z0-9_]*)(["']?)`)
+)
+
+// parseDockerfile splits a Dockerfile into its instructions the way BuildKit
+// does. The parser directives at the top are read for the escape character,
+// which can be changed from "\" to "`", so that line continuations are
+// joined. Comment lines, including the ones inside continuations, aren't
+// instructions, and neither are the lines of heredocs. Both "\n" and "\r\n"
+// line endings are understood. Malformed Dockerfiles, like ones with
+// unterminated heredocs, are parsed as far as they can be, since BuildKit is
+// the one to complain about them.
+func parseDockerfile(contents []byte) []dockerInstruction {
+	var lines []dockerLine
+	for start := 0; start < len(contents); {
+		end := bytes.IndexByte(contents[start:], '\n')
+		next := start + end + 1
+		if end == -1 {
+			end, next = len(contents)-start, len(contents)
+		}
+		end += start
+		if end > start && contents[end-1] == '\r' {
+			end--
+		}
+		lines = append(lines, dockerLine{start, end})
+		start = next
+	}
+	text := func(l dockerLine) string { return string(contents[l.start:l.end]) }
+
+	escape := byte('\\')
+	i := 0
+	for ; i < len(lines); i++ {
+		m := dockerDirectiveRe.FindStringSubmatch(text(lines[i]))
+		if m == nil {
+			break
+		}
+		if strings.ToLower(m[1]) == "escape" && (m[2] == "`" || m[2] == `\`) {
+			escape = m[2][0]
+		}
+	}
+
+	var insts []dockerInstruction
+	for i < len(lines) {
+		if isDockerCommentOrBlank(text(lines[i])) {
+			i++
+			continue
+		}
+		inst := dockerInstruction{start: lines[i].start}
+		var words []dockerWord
+		for i < len(lines) {
+			l := lines[i]
+			i++
+			inst.end = l.end
+			s := text(l)
+			trimmed := strings.TrimRight(s, " \t")
+			continued := len(trimmed) > 0 && trimmed[len(trimmed)-1] == escape
+			if continued {
+				s = trimmed[:len(trimmed)-1]
+			}
+			words = append(words, splitDockerWords(s, l.start)...)
+			if !continued {
+				break
+			}
+			// Comment lines and empty lines don't end a continuation.
+			for i < len(lines) && isDockerCommentOrBlank(text(lines[i])) {
+				i++
+			}
+		}
+		if len(words) == 0 {
+			continue
+		}
+		inst.cmd = strings.ToLower(words[0].text)
+		inst.words = words[1:]
+
+		if inst.cmd == "run" || inst.cmd == "copy" || inst.cmd == "add" {
+			for _, w := range inst.words {
+				for _, m := range dockerHeredocRe.FindAllStringSubmatch(w.text, -1) {
+					stripTabs, name := m[1] == "-", m[3]
+					for i < len(lines) {
+						l := lines[i]
+						i++
+						inst.end = l.end
+						body := text(l)
+						if stripTabs {
+							body = strings.TrimLeft(body, "\t")
+						}
+						if body == name {
+							break
+						}
+					}
+				}
+			}
+		}
+		insts = append(insts, inst)
+	}
+	return insts
+}
+
+func isDockerCommentOrBlank(line string) bool {
+	trimmed := strings.TrimLeft(line, " \t")
+	return trimmed == "" || trimmed[0] == '#'
+}
+
+// splitDockerWords splits s, which starts at the byte offset start of the
+// Dockerfile, on spaces and tabs.
+func splitDockerWords(s string, start int) []dockerWord {
+	var words []dockerWord
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && s[j] != ' ' && s[j] != '\t' {
+			j++
+		}
+		words = append(words, dockerWord{s[i:j], start + i, start + j})
+		i = j
+	}
+	return words
+}
+
+// dockerCodeLines returns the lines of the instructions, leaving out the
+// comment lines between their continuations and in their heredocs, so that
+// things like commented-out download URLs aren't mistaken for real ones.
+func dockerCodeLines(contents []byte, insts []dockerInstruction) []dockerLine {
+	var lines []dockerLine
+	for _, inst := range insts {
+		for start := inst.start; start <= inst.end; {
+			end := bytes.IndexByte(contents[start:inst.end], '\n')
+			next := start + end + 1
+			if end == -1 {
+				end, next = inst.end-start, inst.end+1
+			}
+			end += start
+			if !isDockerCommentOrBlank(string(contents[start:end])) {
+				lines = append(lines, dockerLine{start, end})
+			}
+			start = next
+		}
+	}
+	return lines
+}
+
+// findAllInLines is re.FindAllSubmatchIndex over each of the lines of
+// contents, with the indexes into contents.
+func findAllInLines(re *regexp.Regexp, contents []byte, lines []dockerLine) [][]int {
+	var all [][]int
+	for _, l := range lines {
+		for _, m := range re.FindAllSubmatchIndex(contents[l.start:l.end], -1) {
+			for i := range m {
+				if m[i] != -1 {
+					m[i] += l.start
+				}
+			}
+			all = append(all, m)
+		}
+	}
+	return all
+}
+
+// dockerFlags returns the leading flags, like --from=golang, of the
+// instruction's words.
+func dockerFlags(words []dockerWord) []dockerWord {
+	for i, w := range words {
+		if !strings.HasPrefix(w.text, "--") {
+			return words[:i]
+		}
+	}
+	return words
+}
@@ -0,0 +1,162 @@
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Dockerfiles that don't start from the golang image install Go themselves,
+// like the golang image's own Dockerfile does, by downloading a release's
+// archive and checking it against its SHA-256 checksum:
+//
+//	ENV GOLANG_VERSION 1.21.5
+//	ARG GO_SHA256=e2bc0b3e...
+//	RUN curl -fsSL https://go.dev/dl/go1.21.5.linux-amd64.tar.gz -o go.tgz \
+//		&& echo "$GO_SHA256  go.tgz" | sha256sum -c -
+//
+// The versions in the archives' names and in the GOLANG_VERSION and
+// GO_VERSION variables are pins, and the checksums of the old release's
+// archives are updated along with them.
+var (
+	// goArchiveRe matches the name of a Go release's archive, alone or at
+	// the end of a download URL like "https://go.dev/dl/".
+	goArchiveRe = regexp.MustCompile(`\bgo(\d+\.\d+(?:\.\d+)?(?:(?:rc|beta)\d+)?)\.([a-z0-9]+)-([a-z0-9]+)\.(?:tar\.gz|zip)\b`)
+	// goVersionVarValueRe matches the value of one of goVersionVars.
+	goVersionVarValueRe = regexp.MustCompile(`^["']?(?:go)?(\d+\.\d+(?:\.\d+)?(?:(?:rc|beta)\d+)?)["']?$`)
+	sha256Re            = regexp.MustCompile(`\b[0-9a-f]{64}\b`)
+	// goChecksumVarRe matches the names of variables that keep the checksum
+	// of a Go archive, like GO_SHA256 and GOLANG_SHA256_ARM64.
+	goChecksumVarRe = regexp.MustCompile(`(?i)\bGO(?:LANG)?_\w*SHA256`)
+)
+
+// goVersionVars are the variables that tarball installs conventionally keep
+// the Go version in.
+var goVersionVars = map[string]bool{"GOLANG_VERSION": true, "GO_VERSION": true}
+
+// dockerTarballPins returns the pins of the versions in the Go archive names
+// in a Dockerfile's instructions, insts, and in the version variables set by
+// its ENV and ARG instructions. Archive names in comments are left alone.
+func dockerTarballPins(contents []byte, insts []dockerInstruction) []Pin {
+	var pins []Pin
+	for _, m := range findAllInLines(goArchiveRe, contents, dockerCodeLines(contents, insts)) {
+		pins = append(pins, Pin{string(contents[m[2]:m[3]]), m[2], m[3]})
+	}
+	for _, inst := range insts {
+		if inst.cmd != "env" && inst.cmd != "arg" {
+			continue
+		}
+		for i, w := range inst.words {
+			name, value, valueStart := w.text, "", 0
+			if eq := strings.IndexByte(w.text, '='); eq != -1 {
+				name, value, valueStart = w.text[:eq], w.text[eq+1:], w.start+eq+1
+			} else if inst.cmd == "env" && i == 0 && len(inst.words) > 1 {
+				// The old "ENV name value" form, where the value is the
+				// rest of the instruction.
+				v := inst.words[1]
+				value, valueStart = v.text, v.start
+			}
+			if !goVersionVars[name] {
+				continue
+			}
+			if p, ok := goVersionVarPin(value, valueStart); ok {
+				pins = append(pins, p)
+			}
+		}
+	}
+	return pins
+}
+
+// goVersionVarPin returns the pin of the Go version in value, the value of
+// one of goVersionVars that starts at the byte offset start.
+func goVersionVarPin(value string, start int) (Pin, bool) {
+	m := goVersionVarValueRe.FindStringSubmatchIndex(value)
+	if m == nil {
+		return Pin{}, false
+	}
+	return Pin{value[m[2]:m[3]], start + m[2], start + m[3]}, true
+}
+
+// dockerChecksumEdits returns the edits that replace the checksums of the
+// archives of the releases the pins are on with the checksums of the same
+// archives of the releases t updates them to. Checksums are found by their
+// values, so they're updated wherever they are in the instructions, insts,
+// like in an ARG or inline in a sha256sum command, as long as they're right
+// for the old release. Ones in comments are left alone. Ones that
+// aren't but look like they're meant to be, by being in a variable like
+// GO_SHA256 or on the same line as a Go archive's name, are an error since
+// updating the version would break the install.
+func dockerChecksumEdits(fp string, contents []byte, insts []dockerInstruction, pins []Pin, t Target) ([]Edit, error) {
+	type archive struct {
+		file    ReleaseFile
+		newFile ReleaseFile
+		newVers string
+	}
+	archives := make(map[string]archive)
+	updating := false
+	for _, p := range pins {
+		newRel, newVers, ok := t.ResolveRelease(p.Version)
+		if !ok || newVers == p.Version {
+			continue
+		}
+		updating = true
+		oldRel, ok := findRelease(t.Releases, p.Version)
+		if !ok {
+			continue
+		}
+		for _, f := range oldRel.Files {
+			if f.SHA256 == "" {
+				continue
+			}
+			a := archive{file: f, newVers: newVers}
+			for _, nf := range newRel.Files {
+				if nf.OS == f.OS && nf.Arch == f.Arch && nf.Kind == f.Kind {
+					a.newFile = nf
+					break
+				}
+			}
+			archives[f.SHA256] = a
+		}
+	}
+	if !updating {
+		return nil, nil
+	}
+	var edits []Edit
+	for _, m := range findAllInLines(sha256Re, contents, dockerCodeLines(contents, insts)) {
+		sum := string(contents[m[0]:m[1]])
+		a, ok := archives[sum]
+		if !ok {
+			line := lineAt(contents, m[0])
+			if goChecksumVarRe.Match(line) || goArchiveRe.Match(line) {
+				return nil, fmt.Errorf("unable to update Dockerfile %#v: checksum %s isn't the checksum of any of the archives of the Go release being updated from, so it can't be updated with it", fp, sum)
+			}
+			continue
+		}
+		if a.newFile.SHA256 == "" {
+			return nil, fmt.Errorf("unable to update Dockerfile %#v: Go %s has no %s/%s %s to update the checksum of %s to", fp, a.newVers, a.file.OS, a.file.Arch, a.file.Kind, a.file.Filename)
+		}
+		edits = append(edits, Edit{m[0], m[1], a.newFile.SHA256})
+	}
+	return edits, nil
+}
+
+// findRelease returns the release of the Go version, like "1.21.5".
+func findRelease(releases []Release, goVers string) (Release, bool) {
+	for _, r := range releases {
+		if strings.TrimPrefix(r.Version, "go") == goVers {
+			return r, true
+		}
+	}
+	return Release{}, false
+}
+
+// lineAt returns the line of contents that the byte offset is in.
+func lineAt(contents []byte, offset int) []byte {
+	start := bytes.LastIndexByte(contents[:offset], '\n') + 1
+	end := bytes.IndexByte(contents[offset:], '\n')
+	if end == -1 {
+		return contents[start:]
+	}
+	return contents[start : offset+end]
+}
@@ -0,0 +1,33 @@
+package ensure
+
+import "sort"
+
+// Edit replaces the bytes from Start to End of a file with Text.
+type Edit struct {
+	Start, End int
+	Text       string
+}
+
+// ApplyEdits returns a copy of b with all of the given non-overlapping edits
+// made.
+func ApplyEdits(b []byte, edits []Edit) []byte {
+	sorted := make([]Edit, len(edits))
+	copy(sorted, edits)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	out := make([]byte, 0, len(b))
+	last := 0
+	for _, e := range sorted {
+		out = append(out, b[last:e.Start]...)
+		out = append(out, e.Text...)
+		last = e.End
+	}
+	return append(out, b[last:]...)
+}
+
+// replaceBytes returns a copy of b with the bytes from start to end replaced
+// with s.
+func replaceBytes(b []byte, start, end int, s string) []byte {
+	return ApplyEdits(b, []Edit{{Start: start, End: end, Text: s}})
+}
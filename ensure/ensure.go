@@ -0,0 +1,369 @@
+// Package ensure finds the Go versions pinned in a repository's files and
+// updates them to the latest release of Go. It's the library behind the
+// latest_go_ensurer command and the ensure-latest-go GitHub Action.
+//
+// Each kind of file is handled by an Updater. The built-in ones are returned
+// by DefaultUpdaters, and other file formats can be supported by passing
+// more Updaters alongside them:
+//
+//	updaters := append(ensure.DefaultUpdaters(false), myUpdater{})
+//	repoFiles, err := ensure.DiscoverFiles(root)
+//	// ...
+//	for _, u := range updaters {
+//		matches := ensure.GatherFiles(u, repoFiles, "", nil, nil)
+//		// ...
+//	}
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Pinner finds the Go versions pinned in one type of file. Every Updater is a
+// Pinner, and some types of files, like go.mod, are only ever read.
+type Pinner interface {
+	// Name is the name of the file type as used in config files, like
+	// "dockerfile".
+	Name() string
+	// Description is the human-readable name of the file type used in error
+	// messages, like "Dockerfile".
+	Description() string
+	// Patterns are the glob patterns, relative to the repo's root, of the
+	// files of this type that are updated by default.
+	Patterns() []string
+	// Pins returns the Go versions pinned in the file at fp with the given
+	// contents, in the order they appear in it.
+	Pins(fp string, contents []byte) ([]Pin, error)
+}
+
+// Updater finds and updates the Go versions pinned in one type of file.
+type Updater interface {
+	Pinner
+	// Edits returns the edits to the file at fp with the given contents that
+	// update its pins to the versions t picks for them.
+	Edits(fp string, contents []byte, t Target) ([]Edit, error)
+}
+
+// Pin is a Go version pinned in a file.
+type Pin struct {
+	// Version is the version as it's written in the file, like "1.21.5" or
+	// "1.21". It's empty for pins that don't name a version, like a "FROM
+	// golang" line in a Dockerfile.
+	Version string
+	// Start and End are the byte offsets in the file of the version, or where
+	// it would go for pins without one.
+	Start, End int
+}
+
+// DefaultUpdaters returns the Updaters for all of the built-in file types. If
+// bazelChecksums is set, the SDK checksums in Bazel files are updated along
+// with their versions.
+func DefaultUpdaters(bazelChecksums bool) []Updater {
+	return []Updater{
+		DockerfileUpdater{},
+		ComposeUpdater{},
+		BakeUpdater{},
+		TravisUpdater{},
+		BitbucketUpdater{},
+		AzureUpdater{},
+		GoVersionFileUpdater{},
+		ToolVersionsUpdater{},
+		MiseUpdater{},
+		DevcontainerUpdater{},
+		BazelUpdater{UpdateChecksums: bazelChecksums},
+		MarkerUpdater{},
+		GoToolchainUpdater{},
+	}
+}
+
+// Names returns the names of the given Updaters' file types.
+func Names(updaters []Updater) []string {
+	var names []string
+	for _, u := range updaters {
+		names = append(names, u.Name())
+	}
+	return names
+}
+
+// Update returns the new contents of the file at fp after making the
+// updater's edits to it.
+func Update(u Updater, fp string, contents []byte, t Target) ([]byte, error) {
+	edits, err := u.Edits(fp, contents, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(edits) == 0 {
+		return contents, nil
+	}
+	return ApplyEdits(contents, edits), nil
+}
+
+// FileContent is the new contents of a file that needs to change.
+type FileContent struct {
+	// Type is the name of the type of the file, like "dockerfile".
+	Type string
+	// Path is the absolute path of the file.
+	Path     string
+	Contents []byte
+	// Changes are the file's pins that are changing, in file order.
+	Changes []Change
+}
+
+// OldVersions returns the distinct Go versions, in file order, of the pins in
+// the file that are changing.
+func (fc FileContent) OldVersions() []string {
+	var vers []string
+	for _, c := range fc.Changes {
+		if c.Version != "" && !contains(vers, c.Version) {
+			vers = append(vers, c.Version)
+		}
+	}
+	return vers
+}
+
+// Change is a pin that's being updated, and where it is.
+type Change struct {
+	Pin
+	// NewVersion is the version the pin is being updated to.
+	NewVersion string
+	// Vulns are the known vulnerabilities in Go that affect the pin's
+	// version. It's empty if they haven't been loaded.
+	Vulns []*Vuln
+	// Support is whether the pin's version is still supported, like
+	// SupportEOL.
+	Support string
+	// Line and Column are where the pin's version starts in the file and
+	// EndLine and EndColumn where it ends, exclusive. They all start at 1,
+	// and the columns count characters, not bytes.
+	Line, Column       int
+	EndLine, EndColumn int
+}
+
+// UpdateFiles runs the updater over each of the files at the given absolute
+// paths and returns the ones whose contents need to change. Files whose config
+// rule has the skip policy aren't read at all.
+func UpdateFiles(u Updater, paths []string, ts Targets) ([]FileContent, error) {
+	return updateFiles(u, paths, ts, nil)
+}
+
+// UpdateAllFiles is UpdateFiles for each of the updaters and the paths at the
+// same index. Files matched by more than one updater, like a shell script
+// with both a marked line and a GOTOOLCHAIN setting, are updated by each of
+// them in turn and returned once, with all of their changes.
+func UpdateAllFiles(updaters []Updater, paths [][]string, ts Targets) ([]FileContent, error) {
+	var files []FileContent
+	changed := make(map[string]int)
+	for i, u := range updaters {
+		fcs, err := updateFiles(u, paths[i], ts, func(fp string) ([]byte, bool) {
+			j, ok := changed[fp]
+			if !ok {
+				return nil, false
+			}
+			return files[j].Contents, true
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, fc := range fcs {
+			j, ok := changed[fc.Path]
+			if !ok {
+				changed[fc.Path] = len(files)
+				files = append(files, fc)
+				continue
+			}
+			files[j].Contents = fc.Contents
+			// Edits never add or remove lines, so the lines of the later
+			// updaters' changes are still right for the original file.
+			changes := append(files[j].Changes, fc.Changes...)
+			sort.SliceStable(changes, func(a, b int) bool {
+				if changes[a].Line != changes[b].Line {
+					return changes[a].Line < changes[b].Line
+				}
+				return changes[a].Column < changes[b].Column
+			})
+			files[j].Changes = changes
+		}
+	}
+	return files, nil
+}
+
+// updateFiles is UpdateFiles, but updates the files that updated returns new
+// contents for from those instead of from what's on disk.
+func updateFiles(u Updater, paths []string, ts Targets, updated func(fp string) ([]byte, bool)) ([]FileContent, error) {
+	var files []FileContent
+	for _, fp := range paths {
+		t := ts.ForFile(u.Name(), fp)
+		if t.Policy == PolicySkip {
+			continue
+		}
+		// O_RDWR so we can ensure we can write to the file without doing a
+		// bunch of work first
+		f, err := os.OpenFile(fp, os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open %s %#v for reading: %w", u.Description(), fp, err)
+		}
+		origFileContents, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read contents of %s %#v: %s", u.Description(), fp, err)
+		}
+		if updated != nil {
+			if newContents, ok := updated(fp); ok {
+				origFileContents = newContents
+			}
+		}
+
+		contentsToWrite, err := Update(u, fp, origFileContents, t)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(contentsToWrite, origFileContents) {
+			pins, err := u.Pins(fp, origFileContents)
+			if err != nil {
+				return nil, err
+			}
+			kept, err := keptPins(u, fp, origFileContents)
+			if err != nil {
+				return nil, err
+			}
+			pins = withoutPins(pins, kept)
+			files = append(files, FileContent{Type: u.Name(), Path: fp, Contents: contentsToWrite, Changes: pinChanges(u, origFileContents, pins, t)})
+		}
+	}
+	return files, nil
+}
+
+// pinChanges returns the changes u makes with t to the pins in contents.
+func pinChanges(u Updater, contents []byte, pins []Pin, t Target) []Change {
+	var changes []Change
+	for _, p := range pins {
+		goVers, ok := resolvePin(u, contents, p, t)
+		if !ok || goVers == p.Version {
+			continue
+		}
+		c := Change{
+			Pin:        p,
+			NewVersion: goVers,
+			Vulns:      t.Vulns.Affecting(p.Version, t.Releases),
+			Support:    Support(p.Version, t.Releases),
+		}
+		c.Line, c.Column = lineColumn(contents, p.Start)
+		c.EndLine, c.EndColumn = lineColumn(contents, p.End)
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// pinResolver is implemented by updaters that write the new versions of some
+// of their pins differently than Target.Resolve picks them.
+type pinResolver interface {
+	// ResolvePin is Target.Resolve for the pin p in contents.
+	ResolvePin(contents []byte, p Pin, t Target) (string, bool)
+}
+
+// resolvePin returns the version that u writes for the pin p in contents, and
+// false if it leaves the pin alone.
+func resolvePin(u Updater, contents []byte, p Pin, t Target) (string, bool) {
+	if pr, ok := u.(pinResolver); ok {
+		return pr.ResolvePin(contents, p, t)
+	}
+	return t.Resolve(p.Version)
+}
+
+// matrixUpdater is implemented by updaters of files that can list several Go
+// versions to test against and that add the new version to the list instead
+// of replacing the old ones.
+type matrixUpdater interface {
+	// KeptPins returns the pins in contents that updating leaves in place
+	// because newer versions are added after them.
+	KeptPins(fp string, contents []byte) ([]Pin, error)
+}
+
+// keptPins returns the pins in contents that u leaves in place no matter
+// what version it updates the file to.
+func keptPins(u Updater, fp string, contents []byte) ([]Pin, error) {
+	mu, ok := u.(matrixUpdater)
+	if !ok {
+		return nil, nil
+	}
+	return mu.KeptPins(fp, contents)
+}
+
+// withoutPins returns the pins that aren't in remove.
+func withoutPins(pins, remove []Pin) []Pin {
+	if len(remove) == 0 {
+		return pins
+	}
+	var out []Pin
+	for _, p := range pins {
+		found := false
+		for _, r := range remove {
+			if p == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// pinEdits returns the edits that replace each of the pins with the version t
+// picks for it. newVers, if not nil, adjusts the picked version before it's
+// written.
+func pinEdits(pins []Pin, t Target, newVers func(p Pin, goVers string) string) []Edit {
+	var edits []Edit
+	for _, p := range pins {
+		goVers, ok := t.Resolve(p.Version)
+		if !ok {
+			continue
+		}
+		if newVers != nil {
+			goVers = newVers(p, goVers)
+		}
+		if goVers != p.Version {
+			edits = append(edits, Edit{p.Start, p.End, goVers})
+		}
+	}
+	return edits
+}
+
+// resolveFullVersion is Target.Resolve for pins that have to be the full
+// version of a release, like the names of release archives, whatever the
+// precision.
+func resolveFullVersion(oldVers string, t Target) (string, bool) {
+	rel, _, ok := t.ResolveRelease(oldVers)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimPrefix(rel.Version, "go"), true
+}
+
+// fullVersionEdits is pinEdits for pins that have to be the full version of a
+// release.
+func fullVersionEdits(pins []Pin, t Target) []Edit {
+	var edits []Edit
+	for _, p := range pins {
+		goVers, ok := resolveFullVersion(p.Version, t)
+		if ok && goVers != p.Version {
+			edits = append(edits, Edit{p.Start, p.End, goVers})
+		}
+	}
+	return edits
+}
+
+// wholeFileEdit returns the edit that replaces all of contents with
+// newContents, for updaters that re-encode the files they change.
+func wholeFileEdit(contents, newContents []byte) []Edit {
+	if bytes.Equal(contents, newContents) {
+		return nil
+	}
+	return []Edit{{0, len(contents), string(newContents)}}
+}
@@ -0,0 +1,2375 @@
+package ensure
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testTarget returns a Target that updates every pin to exactly goVers,
+// like the updaters did before there were policies.
+func testTarget(goVers string) Target {
+	return Target{
+		Releases:       []Release{{Version: "go" + goVers, Stable: true}},
+		Policy:         PolicyLatest,
+		Precision:      PrecisionFull,
+		AllowDowngrade: true,
+	}
+}
+
+func TestDockerfileFromUpdate(t *testing.T) {
+	testcases := []struct {
+		origLine    string
+		newImageTag string
+		expected    string
+	}{
+		{
+			"from golangadf aa",
+			"1.13",
+			"from golangadf aa",
+		},
+		{
+			"from    golang:1.1.1 aa",
+			"1.13.1",
+			"from    golang:1.13.1 aa",
+		},
+		{
+			"from golang",
+			"1.2",
+			"from golang:1.2",
+		},
+		{
+			"from golang # foobar",
+			"1.2",
+			"from golang:1.2 # foobar",
+		},
+		{
+			"from golang# foobar",
+			"1.2",
+			"from golang:1.2# foobar",
+		},
+		{
+			"FROM    golang# foobar",
+			"1.2",
+			"FROM    golang:1.2# foobar",
+		},
+		{
+			"FROM golang:1.13.1",
+			"1.1",
+			"FROM golang:1.1",
+		},
+		{
+			"from golang:1.13.1-alpine",
+			"1.13.3",
+			"from golang:1.13.3-alpine",
+		},
+		{
+			"from golang:1.-werd",
+			"1.13.3",
+			"from golang:1.13.3",
+		},
+		{
+			"FROM gcr.io/distroless/static\nCOPY --from=golang:1.13.1 /usr/local/go /usr/local/go\n",
+			"1.13.3",
+			"FROM gcr.io/distroless/static\nCOPY --from=golang:1.13.3 /usr/local/go /usr/local/go\n",
+		},
+		{
+			"FROM alpine\ncopy --chown=1000 --from=golang:1.13-alpine /usr/local/go /go\nCOPY --from=golangci/golangci-lint:v1.55 /usr/bin/golangci-lint /bin\n",
+			"1.13.3",
+			"FROM alpine\ncopy --chown=1000 --from=golang:1.13.3-alpine /usr/local/go /go\nCOPY --from=golangci/golangci-lint:v1.55 /usr/bin/golangci-lint /bin\n",
+		},
+		{
+			"FROM debian\nRUN --mount=type=bind,from=golang:1.13,source=/usr/local/go,target=/go --mount=type=cache,target=/root/.cache \\\n\tgo build ./...\r\n",
+			"1.13.3",
+			"FROM debian\nRUN --mount=type=bind,from=golang:1.13.3,source=/usr/local/go,target=/go --mount=type=cache,target=/root/.cache \\\n\tgo build ./...\r\n",
+		},
+		{
+			"FROM debian\nCOPY --from=golang /usr/local/go /go\r\n",
+			"1.13.3",
+			"FROM debian\nCOPY --from=golang:1.13.3 /usr/local/go /go\r\n",
+		},
+		{
+			"FROM --platform=$BUILDPLATFORM \\\n\tgolang:1.13.1-alpine AS build\r\nRUN <<EOF\nENV GO_VERSION=1.1\nCOPY --from=golang:1.1 / /\nEOF\n",
+			"1.13.3",
+			"FROM --platform=$BUILDPLATFORM \\\n\tgolang:1.13.3-alpine AS build\r\nRUN <<EOF\nENV GO_VERSION=1.1\nCOPY --from=golang:1.1 / /\nEOF\n",
+		},
+		{
+			"# escape=`\r\nFROM golang:1.13.1 `\r\n  AS build\r\nENV GOLANG_VERSION=1.13.1 `\r\n    GOPATH=C:\\gopath\r\n",
+			"1.13.3",
+			"# escape=`\r\nFROM golang:1.13.3 `\r\n  AS build\r\nENV GOLANG_VERSION=1.13.3 `\r\n    GOPATH=C:\\gopath\r\n",
+		},
+		{
+			// --from=golang is the stage, not the image, when there's a
+			// stage named golang.
+			"FROM golang:1.13.1 AS golang\nFROM debian\nCOPY --from=golang /usr/local/go /go\n",
+			"1.13.3",
+			"FROM golang:1.13.3 AS golang\nFROM debian\nCOPY --from=golang /usr/local/go /go\n",
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actual, err := Update(DockerfileUpdater{}, "Dockerfile", []byte(tc.origLine), testTarget(tc.newImageTag))
+			if err != nil {
+				t.Errorf("Update error: %s", err)
+				return
+			}
+			if tc.expected != string(actual) {
+				t.Errorf("want %#v, got %#v", tc.expected, string(actual))
+			}
+		})
+	}
+}
+
+func TestParseDockerfile(t *testing.T) {
+	type inst struct {
+		Cmd   string
+		Words []string
+		Text  string
+	}
+	testcases := []struct {
+		input    string
+		expected []inst
+	}{
+		{
+			input: "# syntax=docker/dockerfile:1\nFROM \\\n  golang:1.21 AS build\r\n",
+			expected: []inst{
+				{"from", []string{"golang:1.21", "AS", "build"}, "FROM \\\n  golang:1.21 AS build"},
+			},
+		},
+		{
+			// Heredoc lines aren't instructions, even when they look like
+			// them.
+			input: "FROM python\nRUN <<EOF python3\nfrom os import path\nEOF\nCOPY <<-\"END\" /app/x.py\n\tfrom golang import x\n\tEND\nRUN true\n",
+			expected: []inst{
+				{"from", []string{"python"}, "FROM python"},
+				{"run", []string{"<<EOF", "python3"}, "RUN <<EOF python3\nfrom os import path\nEOF"},
+				{"copy", []string{`<<-"END"`, "/app/x.py"}, "COPY <<-\"END\" /app/x.py\n\tfrom golang import x\n\tEND"},
+				{"run", []string{"true"}, "RUN true"},
+			},
+		},
+		{
+			// The escape directive changes the continuation character,
+			// and comment and empty lines don't end continuations.
+			input: "# escape=`\r\n\r\nFROM mcr.microsoft.com/windows `\r\n# a comment\r\n\r\n  AS build\r\nRUN dir C:\\\r\n",
+			expected: []inst{
+				{"from", []string{"mcr.microsoft.com/windows", "AS", "build"}, "FROM mcr.microsoft.com/windows `\r\n# a comment\r\n\r\n  AS build"},
+				{"run", []string{"dir", "C:\\"}, "RUN dir C:\\"},
+			},
+		},
+		{
+			// Directives are only read at the top.
+			input: "FROM alpine\n# escape=`\nRUN echo \\\n  hi\n",
+			expected: []inst{
+				{"from", []string{"alpine"}, "FROM alpine"},
+				{"run", []string{"echo", "hi"}, "RUN echo \\\n  hi"},
+			},
+		},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var actual []inst
+			for _, di := range parseDockerfile([]byte(tc.input)) {
+				in := inst{Cmd: di.cmd, Text: tc.input[di.start:di.end]}
+				for _, w := range di.words {
+					if tc.input[w.start:w.end] != w.text {
+						t.Errorf("word %#v has the offsets of %#v", w.text, tc.input[w.start:w.end])
+					}
+					in.Words = append(in.Words, w.text)
+				}
+				actual = append(actual, in)
+			}
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("parseDockerfile (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDockerfileTarballUpdate(t *testing.T) {
+	sum := func(c string) string { return strings.Repeat(c, 64) }
+	target := Target{
+		Releases: []Release{
+			{Version: "go1.22.3", Stable: true, Files: []ReleaseFile{
+				{Filename: "go1.22.3.linux-amd64.tar.gz", OS: "linux", Arch: "amd64", SHA256: sum("b"), Kind: "archive"},
+				{Filename: "go1.22.3.linux-arm64.tar.gz", OS: "linux", Arch: "arm64", SHA256: sum("c"), Kind: "archive"},
+			}},
+			{Version: "go1.21.5", Stable: true, Files: []ReleaseFile{
+				{Filename: "go1.21.5.linux-amd64.tar.gz", OS: "linux", Arch: "amd64", SHA256: sum("a"), Kind: "archive"},
+				{Filename: "go1.21.5.linux-arm64.tar.gz", OS: "linux", Arch: "arm64", SHA256: sum("d"), Kind: "archive"},
+				{Filename: "go1.21.5.linux-s390x.tar.gz", OS: "linux", Arch: "s390x", SHA256: sum("e"), Kind: "archive"},
+			}},
+		},
+		Policy:    PolicyLatest,
+		Precision: PrecisionFull,
+	}
+	testcases := []struct {
+		input       string
+		expected    string
+		expectedErr string
+	}{
+		{
+			input: `FROM debian:bookworm
+ENV GOLANG_VERSION 1.21.5
+RUN arch="$(dpkg --print-architecture)"; \
+	case "$arch" in \
+		amd64) url='https://dl.google.com/go/go1.21.5.linux-amd64.tar.gz'; sha256='` + sum("a") + `' ;; \
+		arm64) url='https://dl.google.com/go/go1.21.5.linux-arm64.tar.gz'; sha256='` + sum("d") + `' ;; \
+	esac; \
+	curl -fsSL "$url" -o go.tgz; \
+	echo "$sha256 *go.tgz" | sha256sum -c -
+`,
+			expected: `FROM debian:bookworm
+ENV GOLANG_VERSION 1.22.3
+RUN arch="$(dpkg --print-architecture)"; \
+	case "$arch" in \
+		amd64) url='https://dl.google.com/go/go1.22.3.linux-amd64.tar.gz'; sha256='` + sum("b") + `' ;; \
+		arm64) url='https://dl.google.com/go/go1.22.3.linux-arm64.tar.gz'; sha256='` + sum("c") + `' ;; \
+	esac; \
+	curl -fsSL "$url" -o go.tgz; \
+	echo "$sha256 *go.tgz" | sha256sum -c -
+`,
+		},
+		{
+			input: `FROM ubuntu:24.04
+ARG GO_VERSION=1.21.5
+ARG GO_SHA256=` + sum("a") + `
+ARG PROTOC_SHA256=` + sum("f") + `
+RUN curl -fsSLO https://go.dev/dl/go${GO_VERSION}.linux-amd64.tar.gz \
+	&& echo "${GO_SHA256}  go${GO_VERSION}.linux-amd64.tar.gz" | sha256sum -c -
+`,
+			expected: `FROM ubuntu:24.04
+ARG GO_VERSION=1.22.3
+ARG GO_SHA256=` + sum("b") + `
+ARG PROTOC_SHA256=` + sum("f") + `
+RUN curl -fsSLO https://go.dev/dl/go${GO_VERSION}.linux-amd64.tar.gz \
+	&& echo "${GO_SHA256}  go${GO_VERSION}.linux-amd64.tar.gz" | sha256sum -c -
+`,
+		},
+		{
+			input: `FROM golang:1.21.5 AS build
+FROM scratch
+ENV GOLANG_VERSION=go1.22.3
+`,
+			expected: `FROM golang:1.22.3 AS build
+FROM scratch
+ENV GOLANG_VERSION=go1.22.3
+`,
+		},
+		{
+			input: `FROM debian:bookworm
+# RUN curl -fsSLO https://go.dev/dl/go1.20.1.linux-amd64.tar.gz && echo "` + sum("9") + `  go1.20.1.linux-amd64.tar.gz" | sha256sum -c -
+RUN curl -fsSLO https://go.dev/dl/go1.21.5.linux-amd64.tar.gz \
+	# was https://go.dev/dl/go1.21.4.linux-amd64.tar.gz ` + sum("a") + `
+	&& echo "` + sum("a") + `  go1.21.5.linux-amd64.tar.gz" | sha256sum -c -
+`,
+			expected: `FROM debian:bookworm
+# RUN curl -fsSLO https://go.dev/dl/go1.20.1.linux-amd64.tar.gz && echo "` + sum("9") + `  go1.20.1.linux-amd64.tar.gz" | sha256sum -c -
+RUN curl -fsSLO https://go.dev/dl/go1.22.3.linux-amd64.tar.gz \
+	# was https://go.dev/dl/go1.21.4.linux-amd64.tar.gz ` + sum("a") + `
+	&& echo "` + sum("b") + `  go1.22.3.linux-amd64.tar.gz" | sha256sum -c -
+`,
+		},
+		{
+			input:       "FROM alpine\nARG GO_SHA256=" + sum("9") + "\nRUN wget https://go.dev/dl/go1.21.5.linux-amd64.tar.gz\n",
+			expectedErr: "checksum " + sum("9") + " isn't the checksum of any of the archives",
+		},
+		{
+			input:       "FROM alpine\nRUN wget https://go.dev/dl/go1.21.5.linux-s390x.tar.gz && echo '" + sum("e") + "  go1.21.5.linux-s390x.tar.gz' | sha256sum -c -\n",
+			expectedErr: "Go 1.22.3 has no linux/s390x archive",
+		},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actual, err := Update(DockerfileUpdater{}, "Dockerfile", []byte(tc.input), target)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("want error containing %#v, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			if diff := cmp.Diff(tc.expected, string(actual)); diff != "" {
+				t.Errorf("Update (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// Archives are only named by their releases' full versions.
+	target.Precision = PrecisionMinor
+	input := "FROM debian\nENV GOLANG_VERSION 1.21.5\nRUN curl -fsSLO https://go.dev/dl/go1.21.5.linux-amd64.tar.gz && echo '" + sum("a") + "  go1.21.5.linux-amd64.tar.gz' | sha256sum -c -\n"
+	expected := "FROM debian\nENV GOLANG_VERSION 1.22.3\nRUN curl -fsSLO https://go.dev/dl/go1.22.3.linux-amd64.tar.gz && echo '" + sum("b") + "  go1.22.3.linux-amd64.tar.gz' | sha256sum -c -\n"
+	actual, err := Update(DockerfileUpdater{}, "Dockerfile", []byte(input), target)
+	if err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+	if diff := cmp.Diff(expected, string(actual)); diff != "" {
+		t.Errorf("Update with minor precision (-want +got):\n%s", diff)
+	}
+	pins, err := DockerfileUpdater{}.Pins("Dockerfile", []byte(input))
+	if err != nil {
+		t.Fatalf("Pins: %s", err)
+	}
+	for _, c := range pinChanges(DockerfileUpdater{}, []byte(input), pins, target) {
+		if c.NewVersion != "1.22.3" {
+			t.Errorf("pinChanges reported %#v as updated to %#v, want 1.22.3", c.Version, c.NewVersion)
+		}
+	}
+}
+
+func TestBakeUpdate(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: `# The Go version used by every target.
+variable "GO_VERSION" {
+  default = "1.21.5" // keep in step with go.mod
+}
+
+variable "GO_IMAGE" { default = "golang:1.21-alpine" }
+
+variable "TAG" {
+  default = "1.21.5"
+}
+
+target "app" {
+  dockerfile = "Dockerfile"
+  args = {
+    GO_VERSION = GO_VERSION
+    OTHER_VERSION = "1.21.5"
+  }
+}
+
+target "tools" {
+  args = {
+    GOLANG_VERSION = "1.21"
+    "GO_VERSION": "1.21.5",
+  }
+}
+`,
+			expected: `# The Go version used by every target.
+variable "GO_VERSION" {
+  default = "1.22.3" // keep in step with go.mod
+}
+
+variable "GO_IMAGE" { default = "golang:1.22.3-alpine" }
+
+variable "TAG" {
+  default = "1.21.5"
+}
+
+target "app" {
+  dockerfile = "Dockerfile"
+  args = {
+    GO_VERSION = GO_VERSION
+    OTHER_VERSION = "1.21.5"
+  }
+}
+
+target "tools" {
+  args = {
+    GOLANG_VERSION = "1.22.3"
+    "GO_VERSION": "1.22.3",
+  }
+}
+`,
+		},
+		{
+			input: `/* GO_VERSION = "1.21.5" */
+variable "GO_VERSION" {
+  default = "${BASE}1.21.5"
+}
+
+target "app" {
+  tags = ["app:${join("-", ["1.21.5", GO_VERSION])}"]
+  labels = {
+    description = <<EOT
+GO_VERSION = "1.21.5"
+EOT
+  }
+  args = {
+    GO_VERSION = "1.21.5-${SUFFIX}"
+  }
+}
+`,
+			expected: `/* GO_VERSION = "1.21.5" */
+variable "GO_VERSION" {
+  default = "${BASE}1.21.5"
+}
+
+target "app" {
+  tags = ["app:${join("-", ["1.21.5", GO_VERSION])}"]
+  labels = {
+    description = <<EOT
+GO_VERSION = "1.21.5"
+EOT
+  }
+  args = {
+    GO_VERSION = "1.21.5-${SUFFIX}"
+  }
+}
+`,
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(BakeUpdater{}, "docker-bake.hcl", []byte(tc.input), testTarget("1.22.3"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("bake file update failed: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+
+	_, err := BakeUpdater{}.Pins("docker-bake.hcl", []byte("variable \"GO_VERSION\" {\n  default = \"1.21.5\n}\n"))
+	if err == nil {
+		t.Errorf("expected an error for an unterminated string")
+	}
+}
+
+func TestTravisGoldenPath(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: `language: go
+go:
+  - 1.13.1
+
+sudo: required
+
+services:
+  - docker
+
+branches:
+  only:
+    - master
+    - /^test_/
+    - /^test-/
+
+install:
+  - go test -race -i .
+
+script:
+  - go test -race . && GOOS=linux GOARCH=amd64 go build -ldflags "-X main.buildSHA=${TRAVIS_COMMIT}" . && ./travis_docker_push.sh
+`,
+			expected: `language: go
+go:
+- "1.22"
+sudo: required
+services:
+- docker
+branches:
+  only:
+  - master
+  - /^test_/
+  - /^test-/
+install:
+- go test -race -i .
+script:
+- go test -race . && GOOS=linux GOARCH=amd64 go build -ldflags "-X main.buildSHA=${TRAVIS_COMMIT}" . && ./travis_docker_push.sh
+`,
+		},
+		{
+			input: `language: go
+go:
+  - 1.13.1
+  - 1.10.0
+
+foobar: foo
+`,
+			expected: `language: go
+go:
+- 1.13.1
+- 1.10.0
+- "1.22"
+foobar: foo
+`,
+		},
+		{
+			input: `language: go
+go: 1.13.1
+branches:
+- nope
+`,
+			expected: `language: go
+go: "1.22"
+branches:
+- nope
+`,
+		},
+
+		{
+			input: `language: go
+branches:
+- nope
+`,
+			expected: `language: go
+branches:
+- nope
+`,
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(TravisUpdater{}, "fake.yml", []byte(tc.input), testTarget("1.22"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("github action file update failed: %s (%s)", cmp.Diff(tc.expected, actual), actual)
+			}
+		})
+	}
+
+}
+
+func TestBitbucketUpdate(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: `# my pipeline
+image: golang:1.13.1
+pipelines:
+  default:
+    - step:
+        script:
+          - go test ./... # ci
+`,
+			expected: `# my pipeline
+image: golang:1.22
+pipelines:
+  default:
+    - step:
+        script:
+          - go test ./... # ci
+`,
+		},
+		{
+			input: `image: node:12
+pipelines:
+  default:
+    - step:
+        image:
+          name: "golang:1.13.1-alpine"  # go
+          username: foo
+        script:
+          - go test ./...
+    - step:
+        image: golang
+        script:
+          - go vet ./...
+  branches:
+    main: # only main
+      - step:
+          image: 'golang:1.13.1'
+          script:
+            - go test ./...
+`,
+			expected: `image: node:12
+pipelines:
+  default:
+    - step:
+        image:
+          name: "golang:1.22-alpine"  # go
+          username: foo
+        script:
+          - go test ./...
+    - step:
+        image: golang:1.22
+        script:
+          - go vet ./...
+  branches:
+    main: # only main
+      - step:
+          image: 'golang:1.22'
+          script:
+            - go test ./...
+`,
+		},
+		{
+			input: `definitions:
+  images:
+    - &go golang:1.13.1
+  steps:
+    - step: &build
+        name: build with golang:1.13.1
+        image: golang:1.13.1
+        script:
+          - go build ./...
+pipelines:
+  default:
+    - step: *build
+    - step:
+        image: *go
+        script:
+          - go test ./...
+  branches:
+    main:
+      - step: *build
+`,
+			expected: `definitions:
+  images:
+    - &go golang:1.22
+  steps:
+    - step: &build
+        name: build with golang:1.13.1
+        image: golang:1.22
+        script:
+          - go build ./...
+pipelines:
+  default:
+    - step: *build
+    - step:
+        image: *go
+        script:
+          - go test ./...
+  branches:
+    main:
+      - step: *build
+`,
+		},
+		{
+			input: `image: golang:1.22
+pipelines:
+  default:
+    - step:
+        script:
+          - go test ./...
+`,
+			expected: `image: golang:1.22
+pipelines:
+  default:
+    - step:
+        script:
+          - go test ./...
+`,
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(BitbucketUpdater{}, "fake.yml", []byte(tc.input), testTarget("1.22"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("bitbucket pipelines file update failed: %s (%s)", cmp.Diff(tc.expected, actual), actual)
+			}
+		})
+	}
+}
+
+func TestComposeUpdate(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: `services:
+  app:
+    image: golang:1.21  # the dev image
+    environment:
+      GO_VERSION: 1.21.5
+  tools:
+    build:
+      context: .
+      args:
+        GO_VERSION: 1.21
+        OTHER: 1.21.5
+  db:
+    image: "postgres:16"
+`,
+			expected: `services:
+  app:
+    image: golang:1.22.3  # the dev image
+    environment:
+      GO_VERSION: 1.21.5
+  tools:
+    build:
+      context: .
+      args:
+        GO_VERSION: 1.22.3
+        OTHER: 1.21.5
+  db:
+    image: "postgres:16"
+`,
+		},
+		{
+			input: `services:
+  app:
+    image: 'golang:1.21.5-alpine'
+    build:
+      args:
+        - "GOLANG_VERSION=1.21.5"
+        - GO_VERSION=
+  lint:
+    image: golang
+`,
+			expected: `services:
+  app:
+    image: 'golang:1.22.3-alpine'
+    build:
+      args:
+        - "GOLANG_VERSION=1.22.3"
+        - GO_VERSION=
+  lint:
+    image: golang:1.22.3
+`,
+		},
+		{
+			input: `services:
+  app:
+    command: ["sh", "-c", "docker pull golang:1.21"]
+    environment:
+      GO_VERSION: "1.21.5"
+    build:
+      args:
+        GO_VERSION: "1.21.5"
+    image: golang:1.21
+`,
+			expected: `services:
+  app:
+    command: ["sh", "-c", "docker pull golang:1.21"]
+    environment:
+      GO_VERSION: "1.21.5"
+    build:
+      args:
+        GO_VERSION: "1.22.3"
+    image: golang:1.22.3
+`,
+		},
+		{
+			input: `"services":
+  "app":
+    "build":
+      "args":
+        "GO_VERSION": "1.21.5"
+        'GOLANG_VERSION' : 1.21
+`,
+			expected: `"services":
+  "app":
+    "build":
+      "args":
+        "GO_VERSION": "1.22.3"
+        'GOLANG_VERSION' : 1.22.3
+`,
+		},
+		{
+			input: `x-go-image: &go golang:1.21.5
+services:
+  app:
+    image: *go
+  test:
+    image: *go
+    build:
+      args:
+        GO_VERSION:
+        GOLANG_VERSION: "1.21.5"
+`,
+			expected: `x-go-image: &go golang:1.22.3
+services:
+  app:
+    image: *go
+  test:
+    image: *go
+    build:
+      args:
+        GO_VERSION:
+        GOLANG_VERSION: "1.22.3"
+`,
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(ComposeUpdater{}, "compose.yaml", []byte(tc.input), testTarget("1.22.3"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("compose file update failed: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+
+	// New versions that would be decoded as numbers are quoted.
+	target := testTarget("1.22.3")
+	target.Precision = PrecisionMinor
+	input := "services:\n  app:\n    image: golang:1.21\n    build:\n      args:\n        GO_VERSION: 1.21\n"
+	actual, err := Update(ComposeUpdater{}, "compose.yaml", []byte(input), target)
+	if err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+	expected := "services:\n  app:\n    image: golang:1.22\n    build:\n      args:\n        GO_VERSION: \"1.22\"\n"
+	if string(actual) != expected {
+		t.Errorf("compose file update with minor precision failed: %s", cmp.Diff(expected, string(actual)))
+	}
+}
+
+func TestAzureUpdate(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: `# ci
+trigger:
+- master # only master
+steps:
+- task: GoTool@0
+  inputs:
+    version: '1.13.1'  # go
+- script: go test ./...
+`,
+			expected: `# ci
+trigger:
+- master # only master
+steps:
+- task: GoTool@0
+  inputs:
+    version: '1.22'  # go
+- script: go test ./...
+`,
+		},
+		{
+			input: `stages:
+- stage: Build
+  jobs:
+  - job: Test
+    steps:
+    - task: GoTool@0
+      inputs:
+        version: 1.13
+    - task: NodeTool@0
+      inputs:
+        version: 1.13
+`,
+			expected: `stages:
+- stage: Build
+  jobs:
+  - job: Test
+    steps:
+    - task: GoTool@0
+      inputs:
+        version: "1.22"
+    - task: NodeTool@0
+      inputs:
+        version: 1.13
+`,
+		},
+		{
+			input: `variables:
+  goVersion: '1.13'
+steps:
+- task: GoTool@0
+  displayName: Use Go 1.13
+  inputs:
+    version: 1.13
+- task: GoTool@0
+  inputs: # the version: 1.13
+    version: '1.13'
+`,
+			expected: `variables:
+  goVersion: '1.13'
+steps:
+- task: GoTool@0
+  displayName: Use Go 1.13
+  inputs:
+    version: "1.22"
+- task: GoTool@0
+  inputs: # the version: 1.13
+    version: '1.22'
+`,
+		},
+		{
+			input: `steps:
+- task: GoTool@0
+  inputs:
+    version: "1.22"
+`,
+			expected: `steps:
+- task: GoTool@0
+  inputs:
+    version: "1.22"
+`,
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(AzureUpdater{}, "fake.yml", []byte(tc.input), testTarget("1.22"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("azure pipelines file update failed: %s (%s)", cmp.Diff(tc.expected, actual), actual)
+			}
+		})
+	}
+
+	// Unquoted versions like 1.20 are decoded as floats, but they're
+	// resolved as they're written.
+	target := Target{
+		Releases:  []Release{{Version: "go1.22.3", Stable: true}, {Version: "go1.20.14", Stable: true}},
+		Policy:    PolicyPatch,
+		Precision: PrecisionFull,
+	}
+	input := "steps:\n- task: GoTool@0\n  inputs:\n    version: 1.20\n"
+	actual, err := Update(AzureUpdater{}, "fake.yml", []byte(input), target)
+	if err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+	expected := "steps:\n- task: GoTool@0\n  inputs:\n    version: 1.20.14\n"
+	if string(actual) != expected {
+		t.Errorf("azure pipelines file update with the patch policy failed: %s", cmp.Diff(expected, string(actual)))
+	}
+}
+
+func TestToolVersionFilesUpdate(t *testing.T) {
+	testcases := []struct {
+		updater  Updater
+		input    string
+		expected string
+	}{
+		{GoVersionFileUpdater{}, "1.13.3", "1.22"},
+		{GoVersionFileUpdater{}, "1.13.3\n", "1.22\n"},
+		{GoVersionFileUpdater{}, "", ""},
+		{
+			ToolVersionsUpdater{},
+			"nodejs 12.1.0\ngolang 1.13.3\nruby 2.6.5 # comment\n",
+			"nodejs 12.1.0\ngolang 1.22\nruby 2.6.5 # comment\n",
+		},
+		{
+			ToolVersionsUpdater{},
+			"golang  1.13.3 1.12.1\r\n# golang 1.11\r\n",
+			"golang  1.22 1.12.1\r\n# golang 1.11\r\n",
+		},
+		{
+			ToolVersionsUpdater{},
+			"golang system\ngopls 0.1.0\n",
+			"golang system\ngopls 0.1.0\n",
+		},
+		{
+			MiseUpdater{},
+			"[env]\ngo = \"1.13\"\n\n[tools]\nnode = \"12\"\ngo   =   '1.13.3'  # pinned\n",
+			"[env]\ngo = \"1.13\"\n\n[tools]\nnode = \"12\"\ngo   =   '1.22'  # pinned\n",
+		},
+		{
+			MiseUpdater{},
+			"[tools]\ngo = [\"1.13\", \"1.12\"]\n",
+			"[tools]\ngo = [\"1.22\", \"1.12\"]\n",
+		},
+		{
+			MiseUpdater{},
+			"tools.go = { version = \"1.13\" }\n[tools]\n\"go\" = \"latest\"\n",
+			"tools.go = { version = \"1.22\" }\n[tools]\n\"go\" = \"latest\"\n",
+		},
+		{
+			MiseUpdater{},
+			"[tools]\nnode = \"20\"\n\n[tools.go]\nversion = \"1.13.3\"  # pinned\npostinstall = \"go version\"\n\n[tools.\"node\"]\nversion = \"1.13\"\n",
+			"[tools]\nnode = \"20\"\n\n[tools.go]\nversion = \"1.22\"  # pinned\npostinstall = \"go version\"\n\n[tools.\"node\"]\nversion = \"1.13\"\n",
+		},
+		{
+			MiseUpdater{},
+			"[ tools . 'go' ]\nversion = '1.13'\n",
+			"[ tools . 'go' ]\nversion = '1.22'\n",
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(tc.updater, "fake", []byte(tc.input), testTarget("1.22"))
+			if err != nil {
+				t.Fatalf("update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("tool version file update failed: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func TestDevcontainerUpdate(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: `// Made by VS Code
+{
+	"name": "Go",
+	"image": "mcr.microsoft.com/devcontainers/go:1-1.13-bookworm", // pinned
+	/* The Go feature. */
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {
+			"version": "1.13.3",
+			"golangciLintVersion": "1.2.3",
+		},
+		"ghcr.io/devcontainers/features/node:1": {
+			"version": "12.1.0",
+		},
+	},
+}
+`,
+			expected: `// Made by VS Code
+{
+	"name": "Go",
+	"image": "mcr.microsoft.com/devcontainers/go:1-1.22-bookworm", // pinned
+	/* The Go feature. */
+	"features": {
+		"ghcr.io/devcontainers/features/go:1": {
+			"version": "1.22.3",
+			"golangciLintVersion": "1.2.3",
+		},
+		"ghcr.io/devcontainers/features/node:1": {
+			"version": "12.1.0",
+		},
+	},
+}
+`,
+		},
+		{
+			input:    `{"image": "golang:1.13-alpine", "features": {"go": "1.13", "ghcr.io/devcontainers/features/go:1": {"version": "latest"}}}`,
+			expected: `{"image": "golang:1.22.3-alpine", "features": {"go": "1.22.3", "ghcr.io/devcontainers/features/go:1": {"version": "latest"}}}`,
+		},
+		{
+			input:    `{"image": "mcr.microsoft.com/devcontainers/go:1.13.1"}`,
+			expected: `{"image": "mcr.microsoft.com/devcontainers/go:1.22.3"}`,
+		},
+		{
+			input:    `{"image": "mcr.microsoft.com/devcontainers/go:1-bookworm"}`,
+			expected: `{"image": "mcr.microsoft.com/devcontainers/go:1-bookworm"}`,
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(DevcontainerUpdater{}, "devcontainer.json", []byte(tc.input), testTarget("1.22.3"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("devcontainer.json file update failed: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func TestBazelUpdate(t *testing.T) {
+	files := []ReleaseFile{
+		{Filename: "go1.22.3.src.tar.gz", Kind: "source", SHA256: "srcsha"},
+		{Filename: "go1.22.3.linux-amd64.tar.gz", OS: "linux", Arch: "amd64", Kind: "archive", SHA256: "linuxsha"},
+		{Filename: "go1.22.3.darwin-arm64.pkg", OS: "darwin", Arch: "arm64", Kind: "installer", SHA256: "pkgsha"},
+		{Filename: "go1.22.3.darwin-arm64.tar.gz", OS: "darwin", Arch: "arm64", Kind: "archive", SHA256: "darwinsha"},
+	}
+	testcases := []struct {
+		input           string
+		updateChecksums bool
+		expected        string
+	}{
+		{
+			input: `module(name = "foo")
+
+bazel_dep(name = "rules_go", version = "0.41.0")
+
+go_sdk = use_extension("@io_bazel_rules_go//go:extensions.bzl", "go_sdk")
+go_sdk.download(version = "1.21.5")  # the "version" of Go
+`,
+			expected: `module(name = "foo")
+
+bazel_dep(name = "rules_go", version = "0.41.0")
+
+go_sdk = use_extension("@io_bazel_rules_go//go:extensions.bzl", "go_sdk")
+go_sdk.download(version = "1.22.3")  # the "version" of Go
+`,
+		},
+		{
+			input: `load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains(
+    nogo = "@//:nogo",
+    version = '1.21.5',
+)
+`,
+			expected: `load("@io_bazel_rules_go//go:deps.bzl", "go_register_toolchains", "go_rules_dependencies")
+
+go_rules_dependencies()
+
+go_register_toolchains(
+    nogo = "@//:nogo",
+    version = '1.22.3',
+)
+`,
+		},
+		{
+			input: `sdk = use_extension("@io_bazel_rules_go//go:extensions.bzl", "go_sdk")
+sdk.download(
+    name = "go_sdk",
+    sdks = {
+        "linux_amd64": ("go1.21.5.linux-amd64.tar.gz", "oldlinuxsha"),
+        "darwin_arm64": (
+            "go1.21.5.darwin-arm64.tar.gz",
+            "olddarwinsha",
+        ),
+    },
+    version = "1.21.5",
+)
+`,
+			updateChecksums: true,
+			expected: `sdk = use_extension("@io_bazel_rules_go//go:extensions.bzl", "go_sdk")
+sdk.download(
+    name = "go_sdk",
+    sdks = {
+        "linux_amd64": ("go1.22.3.linux-amd64.tar.gz", "linuxsha"),
+        "darwin_arm64": (
+            "go1.22.3.darwin-arm64.tar.gz",
+            "darwinsha",
+        ),
+    },
+    version = "1.22.3",
+)
+`,
+		},
+		{
+			input:    `other.download(version = "1.21.5")` + "\n",
+			expected: `other.download(version = "1.21.5")` + "\n",
+		},
+	}
+
+	target := testTarget("1.22.3")
+	target.Releases[0].Files = files
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(BazelUpdater{UpdateChecksums: tc.updateChecksums}, "MODULE.bazel", []byte(tc.input), target)
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("Bazel file update failed: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+
+	_, err := Update(BazelUpdater{}, "WORKSPACE", []byte(`go_download_sdk(name = "go_sdk", version = "1.21.5", sdks = {})`), target)
+	if err == nil {
+		t.Errorf("expected an error when updating a call with sdks without updating checksums")
+	}
+}
+
+func TestMarkedFileUpdate(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"GO_VERSION ?= 1.13.3 # ensure-latest-go: version\nOTHER_VERSION ?= 1.13.3\n",
+			"GO_VERSION ?= 1.22.3 # ensure-latest-go: version\nOTHER_VERSION ?= 1.13.3\n",
+		},
+		{
+			"go_version=\"1.13\"  # ensure-latest-go: version\r\n",
+			"go_version=\"1.22.3\"  # ensure-latest-go: version\r\n",
+		},
+		{
+			"curl -O https://go.dev/dl/go1.13.3.linux-amd64.tar.gz # ensure-latest-go: version\n",
+			"curl -O https://go.dev/dl/go1.22.3.linux-amd64.tar.gz # ensure-latest-go: version\n",
+		},
+		{
+			"  image: alpine3.18-golang:1.13 # ensure-latest-go: version\n",
+			"  image: alpine3.18-golang:1.22.3 # ensure-latest-go: version\n",
+		},
+		{
+			"# ensure-latest-go: version 1.13.3\n",
+			"# ensure-latest-go: version 1.13.3\n",
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			actualBytes, err := Update(MarkerUpdater{}, "Makefile", []byte(tc.input), testTarget("1.22.3"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("marked file update failed: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func TestGoToolchainUpdate(t *testing.T) {
+	testcases := []struct {
+		fp       string
+		input    string
+		expected string
+	}{
+		{
+			"Dockerfile",
+			"FROM debian\nENV GOTOOLCHAIN=go1.21.5\n",
+			"FROM debian\nENV GOTOOLCHAIN=go1.22.3\n",
+		},
+		{
+			"Dockerfile",
+			"FROM golang:1.21\nENV GOTOOLCHAIN go1.21.5+auto\n",
+			"FROM golang:1.22.3\nENV GOTOOLCHAIN go1.22.3+auto\n",
+		},
+		{
+			".github/workflows/ci.yml",
+			"env:\n  GOTOOLCHAIN: go1.21.5+path\n  OTHER: go1.21.5\n",
+			"env:\n  GOTOOLCHAIN: go1.22.3+path\n  OTHER: go1.21.5\n",
+		},
+		{
+			".github/workflows/ci.yml",
+			"env:\n  \"GOTOOLCHAIN\": \"go1.21rc2\"\n",
+			"env:\n  \"GOTOOLCHAIN\": \"go1.22.3\"\n",
+		},
+		{
+			".envrc",
+			"export GOTOOLCHAIN=go1.21.5\n",
+			"export GOTOOLCHAIN=go1.22.3\n",
+		},
+		{
+			"scripts/setup.sh",
+			"go env -w GOTOOLCHAIN=go1.21.5+auto\n",
+			"go env -w GOTOOLCHAIN=go1.22.3+auto\n",
+		},
+		{
+			".envrc",
+			"export GOTOOLCHAIN=local\nexport GOTOOLCHAIN=auto\nexport GOTOOLCHAIN=path\nexport GOTOOLCHAIN=local+auto\n",
+			"export GOTOOLCHAIN=local\nexport GOTOOLCHAIN=auto\nexport GOTOOLCHAIN=path\nexport GOTOOLCHAIN=local+auto\n",
+		},
+		{
+			".envrc",
+			"export GOTOOLCHAIN=go1.21.5-custom\nexport MY_GOTOOLCHAIN=go1.21.5\n",
+			"export GOTOOLCHAIN=go1.21.5-custom\nexport MY_GOTOOLCHAIN=go1.21.5\n",
+		},
+		{
+			".envrc",
+			"# export GOTOOLCHAIN=go1.20.1\nexport GOTOOLCHAIN=go1.21.5 # was GOTOOLCHAIN=go1.20.1\n",
+			"# export GOTOOLCHAIN=go1.20.1\nexport GOTOOLCHAIN=go1.22.3 # was GOTOOLCHAIN=go1.20.1\n",
+		},
+		{
+			".github/workflows/ci.yml",
+			"env:\n  # GOTOOLCHAIN: go1.20.1\n  GOTOOLCHAIN: go1.21.5\n",
+			"env:\n  # GOTOOLCHAIN: go1.20.1\n  GOTOOLCHAIN: go1.22.3\n",
+		},
+	}
+
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var u Updater = GoToolchainUpdater{}
+			if tc.fp == "Dockerfile" {
+				u = DockerfileUpdater{}
+			}
+			actualBytes, err := Update(u, tc.fp, []byte(tc.input), testTarget("1.22.3"))
+			if err != nil {
+				t.Fatalf("Update: %s", err)
+			}
+			actual := string(actualBytes)
+			if tc.expected != actual {
+				t.Errorf("GOTOOLCHAIN update failed: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+
+	// Toolchains are only downloaded by their full versions.
+	target := testTarget("1.22.3")
+	target.Precision = PrecisionMinor
+	actual, err := Update(GoToolchainUpdater{}, ".envrc", []byte("export GOTOOLCHAIN=go1.21.5\n"), target)
+	if err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+	if string(actual) != "export GOTOOLCHAIN=go1.22.3\n" {
+		t.Errorf("GOTOOLCHAIN update with minor precision: %#v", string(actual))
+	}
+
+	// The changes report the versions that are written.
+	for _, tc := range []struct {
+		u        Updater
+		contents string
+	}{
+		{GoToolchainUpdater{}, "export GOTOOLCHAIN=go1.21.5\n"},
+		{DockerfileUpdater{}, "FROM golang:1.21.5\n# ENV GOTOOLCHAIN=go1.20.1\nENV GOTOOLCHAIN=go1.21.5+auto\n"},
+	} {
+		contents := []byte(tc.contents)
+		pins, err := tc.u.Pins("fake", contents)
+		if err != nil {
+			t.Fatalf("Pins: %s", err)
+		}
+		edits, err := tc.u.Edits("fake", contents, target)
+		if err != nil {
+			t.Fatalf("Edits: %s", err)
+		}
+		written := make(map[int]string)
+		for _, e := range edits {
+			written[e.Start] = e.Text
+		}
+		reported := make(map[int]string)
+		for _, c := range pinChanges(tc.u, contents, pins, target) {
+			reported[c.Start] = c.NewVersion
+		}
+		if diff := cmp.Diff(written, reported); diff != "" {
+			t.Errorf("%s changes don't match edits (-written +reported):\n%s", tc.u.Name(), diff)
+		}
+	}
+}
+
+func TestVersionTargetResolve(t *testing.T) {
+	releases := []Release{
+		{Version: "go1.22.3", Stable: true},
+		{Version: "go1.22.2", Stable: true},
+		{Version: "go1.21.10", Stable: true},
+		{Version: "go1.20", Stable: true},
+	}
+	testcases := []struct {
+		policy         string
+		precision      string
+		allowDowngrade bool
+		old            string
+		expected       string
+		expectedOK     bool
+	}{
+		{PolicyLatest, PrecisionFull, false, "1.21.5", "1.22.3", true},
+		{PolicyLatest, PrecisionFull, false, "", "1.22.3", true},
+		{PolicyLatest, PrecisionMinor, false, "1.21.5", "1.22", true},
+		{PolicyLatest, PrecisionPreserve, false, "1.21", "1.22", true},
+		{PolicyLatest, PrecisionPreserve, false, "1.21.5", "1.22.3", true},
+		{PolicyPatch, PrecisionFull, false, "1.21.5", "1.21.10", true},
+		{PolicyPatch, PrecisionFull, false, "1.20", "1.20", true},
+		{PolicyPatch, PrecisionFull, false, "1.19.2", "", false},
+		{PolicyPatch, PrecisionFull, false, "", "", false},
+		{PolicySkip, PrecisionFull, false, "1.21.5", "", false},
+		{PolicyLatest, PrecisionFull, false, "1.23rc1", "", false},
+		{PolicyLatest, PrecisionFull, true, "1.23rc1", "1.22.3", true},
+		{PolicyLatest, PrecisionFull, false, "1.22rc1", "1.22.3", true},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			target := Target{
+				Releases:       releases,
+				Policy:         tc.policy,
+				Precision:      tc.precision,
+				AllowDowngrade: tc.allowDowngrade,
+			}
+			actual, ok := target.Resolve(tc.old)
+			if ok != tc.expectedOK || actual != tc.expected {
+				t.Errorf("resolve(%#v): want %#v, %t, got %#v, %t", tc.old, tc.expected, tc.expectedOK, actual, ok)
+			}
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	testcases := []struct {
+		input       string
+		expectedErr string
+	}{
+		{
+			input: `rules:
+  - paths: ["services/**"]
+    exclude:
+      - services/legacy/**
+    types: [dockerfile, travis]
+    policy: patch
+    allow_downgrade: true
+    precision: minor
+`,
+		},
+		{
+			input: `rules:
+  - paths: ["services/**"]
+    polcy: patch
+`,
+			expectedErr: "line 3: field polcy not found",
+		},
+		{
+			input: `# Our rules.
+rules:
+- paths: ["**"]
+- types: [dockerfile]
+
+  policy: newest
+`,
+			expectedErr: `line 6: rules[1].policy: unknown policy "newest"`,
+		},
+		{
+			input: `rules:
+  - types:
+      - dockerfile
+      - circleci
+`,
+			expectedErr: `line 4: rules[0].types[1]: unknown file type "circleci"`,
+		},
+		{
+			input: `rules:
+  - exclude: ["[abc"]
+`,
+			expectedErr: `line 2: rules[0].exclude[0]: malformed glob pattern "[abc"`,
+		},
+		{
+			input: `rules:
+  - precision: all
+    paths:
+      - "**"
+`,
+			expectedErr: `line 2: rules[0].precision: unknown precision "all"`,
+		},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			_, err := ParseConfig([]byte(tc.input), Names(DefaultUpdaters(false)))
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("ParseConfig: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("want error containing %#v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestConfigRuleFor(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`rules:
+  - paths: ["services/**"]
+    exclude: ["services/legacy/**"]
+    policy: patch
+  - paths: ["services/**/Dockerfile"]
+    types: [dockerfile]
+    precision: minor
+`), Names(DefaultUpdaters(false)))
+	if err != nil {
+		t.Fatalf("ParseConfig: %s", err)
+	}
+	testcases := []struct {
+		fileType          string
+		relPath           string
+		expectedPolicy    string
+		expectedPrecision string
+	}{
+		{"dockerfile", "Dockerfile", PolicyLatest, PrecisionFull},
+		{"travis", "services/.travis.yml", PolicyPatch, PrecisionFull},
+		{"travis", "services/legacy/.travis.yml", PolicyLatest, PrecisionFull},
+		{"dockerfile", "services/a/b/Dockerfile", PolicyLatest, PrecisionMinor},
+		{"dockerfile", "services/Dockerfile", PolicyLatest, PrecisionMinor},
+		{"marker", "services/Dockerfile", PolicyPatch, PrecisionFull},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rule := cfg.RuleFor(tc.fileType, tc.relPath)
+			if rule.Policy != tc.expectedPolicy || rule.Precision != tc.expectedPrecision {
+				t.Errorf("RuleFor(%#v, %#v): want policy %#v and precision %#v, got %#v and %#v", tc.fileType, tc.relPath, tc.expectedPolicy, tc.expectedPrecision, rule.Policy, rule.Precision)
+			}
+		})
+	}
+}
+
+func TestGlobList(t *testing.T) {
+	testcases := []struct {
+		patterns string
+		path     string
+		expected bool
+	}{
+		{"services/**/Dockerfile", "services/Dockerfile", true},
+		{"services/**/Dockerfile", "services/a/b/Dockerfile", true},
+		{"services/**/Dockerfile", "services/a/Dockerfile.dev", false},
+		{"services/**/Dockerfile", "other/services/Dockerfile", false},
+		{"*.sh", "install.sh", true},
+		{"*.sh", "scripts/install.sh", false},
+		{"**", "a/b/c", true},
+		{"legacy/**", "legacy", true},
+		{"legacy/**,!legacy/keep/**", "legacy/a/Dockerfile", true},
+		{"legacy/**,!legacy/keep/**", "legacy/keep/Dockerfile", false},
+		{"!legacy/**", "Dockerfile", true},
+		{"!legacy/**", "legacy/Dockerfile", false},
+		{"", "Dockerfile", false},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			gl, err := ParseGlobList(tc.patterns)
+			if err != nil {
+				t.Fatalf("ParseGlobList: %s", err)
+			}
+			actual, _ := gl.Match(tc.path)
+			if actual != tc.expected {
+				t.Errorf("%#v matching %#v: want %t, got %t", tc.patterns, tc.path, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGatherFiles(t *testing.T) {
+	repoFiles := []string{
+		".github/versions/go",
+		".go-version",
+		"Dockerfile",
+		"legacy/Dockerfile",
+		"legacy/keep/Dockerfile",
+		"services/api/Dockerfile",
+	}
+	excludes := GlobList{".github/versions/go", "legacy/**", "!legacy/keep/**"}
+	var included []string
+	for _, u := range DefaultUpdaters(false) {
+		for _, m := range GatherFiles(u, repoFiles, "", nil, excludes) {
+			if m.ExcludedBy == "" {
+				included = append(included, m.Path)
+			}
+		}
+	}
+	expected := []string{".go-version", "Dockerfile", "legacy/keep/Dockerfile", "services/api/Dockerfile"}
+	sort.Strings(included)
+	if !cmp.Equal(expected, included) {
+		t.Errorf("included files: %s", cmp.Diff(expected, included))
+	}
+
+	patterns, err := ParseInputPatterns("/repo", "./services/**/Dockerfile,/repo/missing/Dockerfile")
+	if err != nil {
+		t.Fatalf("ParseInputPatterns: %s", err)
+	}
+	var actual []string
+	for _, m := range GatherFiles(DockerfileUpdater{}, repoFiles, "dockerfiles", patterns, nil) {
+		actual = append(actual, m.Path)
+	}
+	expected = []string{"missing/Dockerfile", "services/api/Dockerfile"}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("dockerfiles patterns: %s", cmp.Diff(expected, actual))
+	}
+}
+
+func TestDiscoverRepoFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		".gitignore":                  "/build/\n*.log\n!keep.log\n",
+		".git/info/exclude":           "local/\n",
+		".git/HEAD":                   "",
+		"Dockerfile":                  "",
+		"Dockerfile.dev":              "",
+		"Dockerfile.dockerignore":     "",
+		"api.Dockerfile":              "",
+		"services/Containerfile":      "",
+		"services/.gitignore":         "tmp\n",
+		"services/tmp/Dockerfile":     "",
+		"services/a/tmp":              "",
+		"tmp/Dockerfile":              "",
+		"build/Dockerfile":            "",
+		"local/Dockerfile":            "",
+		"out.log":                     "",
+		"keep.log":                    "",
+		"vendor/x/Dockerfile":         "",
+		"web/node_modules/Dockerfile": "",
+	}
+	for fp, contents := range files {
+		fp = filepath.Join(root, filepath.FromSlash(fp))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "services"), filepath.Join(root, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "Dockerfile"), filepath.Join(root, "link.Dockerfile")); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := DiscoverFiles(root)
+	if err != nil {
+		t.Fatalf("DiscoverFiles: %s", err)
+	}
+	expected := []string{
+		".gitignore",
+		"Dockerfile",
+		"Dockerfile.dev",
+		"Dockerfile.dockerignore",
+		"api.Dockerfile",
+		"keep.log",
+		"services/.gitignore",
+		"services/Containerfile",
+		"tmp/Dockerfile",
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("discovered files: %s", cmp.Diff(expected, actual))
+	}
+
+	var dockerfiles []string
+	for _, m := range GatherFiles(DockerfileUpdater{}, actual, "", nil, nil) {
+		dockerfiles = append(dockerfiles, m.Path)
+	}
+	expected = []string{"Dockerfile", "Dockerfile.dev", "api.Dockerfile", "services/Containerfile", "tmp/Dockerfile"}
+	if !cmp.Equal(expected, dockerfiles) {
+		t.Errorf("dockerfiles: %s", cmp.Diff(expected, dockerfiles))
+	}
+}
+
+func TestPins(t *testing.T) {
+	testcases := []struct {
+		updater  Pinner
+		input    string
+		expected []string
+	}{
+		{DockerfileUpdater{}, "# build\nFROM golang:1.21.5-alpine AS build\nFROM golang:1.20\n", []string{"1.21.5"}},
+		{DockerfileUpdater{}, "FROM golang AS build\n", []string{""}},
+		{DockerfileUpdater{}, "FROM debian\nENV GOLANG_VERSION 1.21.5\nRUN curl -O https://go.dev/dl/go1.21.4.linux-amd64.tar.gz\n", []string{"1.21.5", "1.21.4"}},
+		{TravisUpdater{}, "language: go\n# go: 1.11\ngo:\n  - \"1.12\"\n  - 1.13.x\n", []string{"1.12", "1.13.x"}},
+		{BitbucketUpdater{}, "image: golang:1.13.1\npipelines:\n  default:\n    - step:\n        image:\n          name: golang:1.13.1-alpine\n", []string{"1.13.1", "1.13.1"}},
+		{AzureUpdater{}, "steps:\n- task: GoTool@0\n  inputs:\n    version: 1.10\n", []string{"1.10"}},
+		{GoVersionFileUpdater{}, "\n1.21.5\n", []string{"1.21.5"}},
+		{ToolVersionsUpdater{}, "nodejs 12\ngolang 1.21.5 1.20\n", []string{"1.21.5"}},
+		{MiseUpdater{}, "[tools]\ngo = '1.21'\n", []string{"1.21"}},
+		{DevcontainerUpdater{}, `{"image": "mcr.microsoft.com/devcontainers/go:1-1.21-bookworm", "features": {"ghcr.io/devcontainers/features/go:1": {"version": "1.21.5"}}}`, []string{"1.21", "1.21.5"}},
+		{BazelUpdater{}, `go_sdk.download(version = r"1.21.5")`, []string{"1.21.5"}},
+		{MarkerUpdater{}, "GO := 1.21.5 # ensure-latest-go: version\nOTHER := 1.2.3\n", []string{"1.21.5"}},
+		{GoModPinner{}, "module example.com/m\n\ngo 1.21\n\ntoolchain go1.22.3 // for the new loopvar\n", []string{"1.22.3"}},
+		{GoModPinner{}, "module example.com/m\n\ngo 1.21.0\n", []string{"1.21.0"}},
+	}
+	for i, tc := range testcases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			pins, err := tc.updater.Pins("fake", []byte(tc.input))
+			if err != nil {
+				t.Fatalf("Pins: %s", err)
+			}
+			var actual []string
+			for _, p := range pins {
+				// The offsets must point at the version as it's written.
+				if got := tc.input[p.Start:p.End]; got != p.Version {
+					t.Errorf("pin %#v has offsets of %#v", p.Version, got)
+				}
+				actual = append(actual, p.Version)
+			}
+			if !cmp.Equal(tc.expected, actual) {
+				t.Errorf("pins: %s", cmp.Diff(tc.expected, actual))
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	releases := []Release{
+		{Version: "go1.22.3", Stable: true},
+		{Version: "go1.22.2", Stable: true},
+		{Version: "go1.21.10", Stable: true},
+		{Version: "go1.21.5", Stable: true},
+		{Version: "go1.20.14", Stable: true},
+	}
+	pins := []PinReport{
+		{Path: "Dockerfile", Version: "1.20.5"},
+		{Path: "Dockerfile.dev", Version: ""},
+		{Path: ".go-version", Version: "1.22.3"},
+		{Path: "go.mod", Version: "1.22.2"},
+		{Path: "mise.toml", Version: "1.22"},
+		{Path: ".travis.yml", Version: "tip"},
+		{Path: "ci.sh", Version: "1.21.10"},
+	}
+	expected := []PinReport{
+		{Path: "Dockerfile", Version: "1.20.5", Status: StatusBehind, Support: SupportEOL, MinorsBehind: 2, PatchesBehind: 9, DisagreesWith: ".go-version:0"},
+		{Path: "Dockerfile.dev", Version: "", Status: StatusUnpinned, Support: SupportCurrent},
+		{Path: ".go-version", Version: "1.22.3", Status: StatusLatest, Support: SupportCurrent},
+		{Path: "go.mod", Version: "1.22.2", Status: StatusBehind, Support: SupportBehind, PatchesBehind: 1},
+		{Path: "mise.toml", Version: "1.22", Status: StatusLatest, Support: SupportCurrent},
+		{Path: ".travis.yml", Version: "tip", Status: StatusUnknown},
+		{Path: "ci.sh", Version: "1.21.10", Status: StatusBehind, Support: SupportBehind, MinorsBehind: 1, DisagreesWith: ".go-version:0"},
+	}
+	r := NewReport(pins, releases)
+	if r.Latest != "1.22.3" {
+		t.Errorf("latest: %#v", r.Latest)
+	}
+	if diff := cmp.Diff(expected, r.Pins); diff != "" {
+		t.Errorf("pins (-want +got):\n%s", diff)
+	}
+	behind := []string{"2 minor versions and 9 patch releases behind", "no version pinned", "up to date", "1 patch release behind", "up to date", "unknown version", "1 minor version behind"}
+	for i, p := range r.Pins {
+		if p.Behind() != behind[i] {
+			t.Errorf("%s: want %#v, got %#v", p.Path, behind[i], p.Behind())
+		}
+	}
+
+	line, col := lineColumn([]byte("# héllo\nFROM golang:1.21.5\n"), len("# héllo\nFROM golang:"))
+	if line != 2 || col != 13 {
+		t.Errorf("lineColumn: %d:%d", line, col)
+	}
+	line, col = lineColumn([]byte("é 1.21.5"), len("é "))
+	if line != 1 || col != 3 {
+		t.Errorf("lineColumn with a multibyte character: %d:%d", line, col)
+	}
+}
+
+func TestUpdateFilesChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "Dockerfile")
+	contents := "# Café's build\nFROM golang:1.21.5 AS build\n"
+	if err := ioutil.WriteFile(fp, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts := Targets{Config: &Config{}, Root: dir, Releases: []Release{{Version: "go1.22.3", Stable: true}}}
+	fcs, err := UpdateFiles(DockerfileUpdater{}, []string{fp}, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := strings.Index(contents, "1.21.5")
+	expected := []FileContent{{
+		Type:     "dockerfile",
+		Path:     fp,
+		Contents: []byte("# Café's build\nFROM golang:1.22.3 AS build\n"),
+		Changes: []Change{{
+			Pin:        Pin{"1.21.5", start, start + len("1.21.5")},
+			NewVersion: "1.22.3",
+			Support:    SupportBehind,
+			Line:       2, Column: 13,
+			EndLine: 2, EndColumn: 19,
+		}},
+	}}
+	if diff := cmp.Diff(expected, fcs); diff != "" {
+		t.Errorf("UpdateFiles (-want +got):\n%s", diff)
+	}
+	if vers := fcs[0].OldVersions(); !cmp.Equal(vers, []string{"1.21.5"}) {
+		t.Errorf("OldVersions: %#v", vers)
+	}
+}
+
+func TestUpdateAllFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "setup.sh")
+	contents := "GO_VERSION=1.21.5 # ensure-latest-go: version\ngo env -w GOTOOLCHAIN=go1.21.5+auto\n"
+	if err := ioutil.WriteFile(fp, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts := Targets{Config: &Config{}, Root: dir, Releases: []Release{{Version: "go1.22.3", Stable: true}}}
+	fcs, err := UpdateAllFiles([]Updater{MarkerUpdater{}, GoToolchainUpdater{}}, [][]string{{fp}, {fp}}, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fcs) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(fcs))
+	}
+	expected := "GO_VERSION=1.22.3 # ensure-latest-go: version\ngo env -w GOTOOLCHAIN=go1.22.3+auto\n"
+	if diff := cmp.Diff(expected, string(fcs[0].Contents)); diff != "" {
+		t.Errorf("UpdateAllFiles contents (-want +got):\n%s", diff)
+	}
+	var lines []int
+	for _, c := range fcs[0].Changes {
+		lines = append(lines, c.Line)
+	}
+	if !cmp.Equal(lines, []int{1, 2}) {
+		t.Errorf("UpdateAllFiles change lines: %v", lines)
+	}
+}
+
+func TestSupport(t *testing.T) {
+	releases := []Release{
+		{Version: "go1.22.3", Stable: true},
+		{Version: "go1.21.10", Stable: true},
+		{Version: "go1.20.14", Stable: true},
+	}
+	testcases := []struct {
+		pinned   string
+		expected string
+	}{
+		{"", SupportCurrent},
+		{"1.22.3", SupportCurrent},
+		{"1.22", SupportCurrent},
+		{"1.23rc1", SupportCurrent},
+		{"1.22.2", SupportBehind},
+		{"1.22rc2", SupportBehind},
+		{"1.21", SupportBehind},
+		{"1.21.10", SupportBehind},
+		{"1.20.14", SupportEOL},
+		{"1.10.0", SupportEOL},
+		{"1.13.x", ""},
+	}
+	for _, tc := range testcases {
+		if actual := Support(tc.pinned, releases); actual != tc.expected {
+			t.Errorf("Support(%#v): want %#v, got %#v", tc.pinned, tc.expected, actual)
+		}
+	}
+	if minors := SupportedMinors(releases); !cmp.Equal(minors, []string{"1.22", "1.21"}) {
+		t.Errorf("SupportedMinors: %#v", minors)
+	}
+
+	dir, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	travis := filepath.Join(dir, ".travis.yml")
+	if err := ioutil.WriteFile(travis, []byte("language: go\ngo:\n  - 1.13.1\n  - 1.10.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(dir, "legacy", ".travis.yml")
+	if err := os.MkdirAll(filepath.Dir(legacy), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(legacy, []byte("go: 1.20.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseConfig([]byte("rules:\n  - paths: [legacy/**]\n    policy: patch\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := Targets{Config: cfg, Root: dir, Releases: releases}
+
+	// The matrix's newest entry is the one that's updated, and the older
+	// one is kept. The patch policy only gets the legacy file as far as
+	// 1.20.14, which is still end-of-life.
+	fcs, err := UpdateFiles(TravisUpdater{}, []string{travis}, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fcs) != 1 || len(fcs[0].Changes) != 1 || fcs[0].Changes[0].Version != "1.13.1" || fcs[0].Changes[0].Support != SupportEOL {
+		t.Errorf("UpdateFiles changes: %#v", fcs)
+	}
+	unsupported, err := UnsupportedPins(TravisUpdater{}, []string{travis, legacy}, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []UnsupportedPin{
+		{
+			PinReport:  PinReport{Type: "travis", Path: ".travis.yml", Line: 4, Column: 5, Version: "1.10.0", Support: SupportEOL},
+			Kept:       true,
+			NewVersion: "1.10.0",
+		},
+		{
+			PinReport:  PinReport{Type: "travis", Path: "legacy/.travis.yml", Line: 1, Column: 5, Version: "1.20.5", Support: SupportEOL},
+			NewVersion: "1.20.14",
+		},
+	}
+	if diff := cmp.Diff(expected, unsupported); diff != "" {
+		t.Errorf("UnsupportedPins (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "build.sh")
+	version := filepath.Join(dir, ".go-version")
+	if err := ioutil.WriteFile(script, []byte("GO=1.21.5\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(version, []byte("1.21.5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The umask shouldn't get in the way of the original permissions.
+	if err := os.Chmod(script, 0775); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(version, link); err != nil {
+		t.Fatal(err)
+	}
+	readAll := func() []string {
+		var out []string
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range infos {
+			b, _ := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+			out = append(out, fmt.Sprintf("%s %s %q", info.Name(), info.Mode(), b))
+		}
+		return out
+	}
+	orig := readAll()
+
+	// A failed rename puts back the files already written.
+	renames := 0
+	renameFile = func(from, to string) error {
+		renames++
+		if renames == 2 {
+			return fmt.Errorf("disk on fire")
+		}
+		return os.Rename(from, to)
+	}
+	defer func() { renameFile = os.Rename }()
+	err = WriteFiles([]FileContent{{Path: script, Contents: []byte("GO=1.22.3\n")}, {Path: version, Contents: []byte("1.22.3\n")}})
+	if err == nil || !strings.Contains(err.Error(), "disk on fire") {
+		t.Errorf("want the rename error, got %v", err)
+	}
+	if actual := readAll(); !cmp.Equal(orig, actual) {
+		t.Errorf("files after failed rename: %s", cmp.Diff(orig, actual))
+	}
+
+	// A failed restore doesn't stop the files after it from being restored.
+	third := filepath.Join(dir, "tools.sh")
+	if err := ioutil.WriteFile(third, []byte("GO=1.21.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	origWithThird := readAll()
+	renames = 0
+	renameFile = func(from, to string) error {
+		renames++
+		// Renames 1 and 2 write script and version, 3 fails to write
+		// third, and 4 is the restore of script.
+		if renames == 3 || renames == 4 {
+			return fmt.Errorf("disk on fire %d", renames)
+		}
+		return os.Rename(from, to)
+	}
+	err = WriteFiles([]FileContent{
+		{Path: script, Contents: []byte("GO=1.22.3\n")},
+		{Path: version, Contents: []byte("1.22.3\n")},
+		{Path: third, Contents: []byte("GO=1.22.3\n")},
+	})
+	if err == nil || !strings.Contains(err.Error(), "disk on fire 3") || !strings.Contains(err.Error(), "disk on fire 4") || !strings.Contains(err.Error(), script) {
+		t.Errorf("want the rename and restore errors, got %v", err)
+	}
+	expectedAfterRestore := make([]string, len(origWithThird))
+	copy(expectedAfterRestore, origWithThird)
+	for i, f := range expectedAfterRestore {
+		if strings.HasPrefix(f, "build.sh ") {
+			expectedAfterRestore[i] = `build.sh -rwxrwxr-x "GO=1.22.3\n"`
+		}
+	}
+	if actual := readAll(); !cmp.Equal(expectedAfterRestore, actual) {
+		t.Errorf("files after failed restore: %s", cmp.Diff(expectedAfterRestore, actual))
+	}
+	if err := os.Remove(third); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(script, []byte("GO=1.21.5\n"), 0775); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed write changes nothing.
+	renameFile = os.Rename
+	err = WriteFiles([]FileContent{{Path: script, Contents: []byte("GO=1.22.3\n")}, {Path: filepath.Join(dir, "missing", "file"), Contents: []byte("1.22.3\n")}})
+	if err == nil {
+		t.Errorf("want an error writing a file in a missing directory")
+	}
+	if actual := readAll(); !cmp.Equal(orig, actual) {
+		t.Errorf("files after failed write: %s", cmp.Diff(orig, actual))
+	}
+
+	err = WriteFiles([]FileContent{{Path: script, Contents: []byte("GO=1.22.3\n")}, {Path: link, Contents: []byte("1.22.3\n")}})
+	if err != nil {
+		t.Fatalf("WriteFiles: %s", err)
+	}
+	expected := []string{
+		`.go-version -rw------- "1.22.3\n"`,
+		`build.sh -rwxrwxr-x "GO=1.22.3\n"`,
+		`link Lrwxrwxrwx "1.22.3\n"`,
+	}
+	if actual := readAll(); !cmp.Equal(expected, actual) {
+		t.Errorf("written files: %s", cmp.Diff(expected, actual))
+	}
+}
+
+func TestGitHubPullRequests(t *testing.T) {
+	type request struct {
+		Method, Path, Auth string
+		Body               map[string]interface{}
+	}
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{Method: r.Method, Path: r.URL.RequestURI(), Auth: r.Header.Get("Authorization")}
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&req.Body)
+		}
+		requests = append(requests, req)
+		switch {
+		case r.Method == "GET" && r.URL.Query().Get("page") == "":
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s/api/v3/repos/o/r/pulls?page=2>; rel="next", <http://%s/api/v3/repos/o/r/pulls?page=2>; rel="last"`, r.Host, r.Host))
+			fmt.Fprint(w, `[{"number": 1, "body": "someone else's", "head": {"ref": "feature"}}]`)
+		case r.Method == "GET":
+			fmt.Fprint(w, `[{"number": 2, "body": "Updates Go.\n\n<!-- ensure-latest-go: 1.22.2 -->\n", "head": {"ref": "ensure-latest-go/patch-1.22.2"}}]`)
+		case r.Method == "POST" && r.URL.Path == "/api/v3/repos/o/r/pulls":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message": "Validation Failed"}`)
+		case r.Method == "PATCH":
+			fmt.Fprint(w, `{"number": 2, "html_url": "https://github.example.com/o/r/pull/2"}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+	gh := &GitHub{BaseURL: srv.URL + "/api/v3/", Token: "t0ken"}
+
+	pr, err := gh.FindPullRequest("o/r", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := pr.Version(); pr.Number != 2 || v != "1.22.2" || pr.Head.Ref != "ensure-latest-go/patch-1.22.2" {
+		t.Errorf("FindPullRequest: %#v, version %#v", pr, v)
+	}
+	pr, err = gh.UpdatePullRequest("o/r", 2, "title", "body")
+	if err != nil || pr.HTMLURL != "https://github.example.com/o/r/pull/2" {
+		t.Errorf("UpdatePullRequest: %#v, %v", pr, err)
+	}
+	if err := gh.AddLabels("o/r", 2, []string{"dependencies", "go"}); err != nil {
+		t.Error(err)
+	}
+	if err := gh.RequestReviewers("o/r", 2, []string{"octocat", "o/gophers"}); err != nil {
+		t.Error(err)
+	}
+	_, err = gh.CreatePullRequest("o/r", "head", "main", "title", "body")
+	if err == nil || !strings.Contains(err.Error(), "422: Validation Failed") {
+		t.Errorf("CreatePullRequest error: %v", err)
+	}
+
+	expected := []request{
+		{"GET", "/api/v3/repos/o/r/pulls?base=main&per_page=100&state=open", "Bearer t0ken", nil},
+		{"GET", "/api/v3/repos/o/r/pulls?page=2", "Bearer t0ken", nil},
+		{"PATCH", "/api/v3/repos/o/r/pulls/2", "Bearer t0ken", map[string]interface{}{"title": "title", "body": "body"}},
+		{"POST", "/api/v3/repos/o/r/issues/2/labels", "Bearer t0ken", map[string]interface{}{"labels": []interface{}{"dependencies", "go"}}},
+		{"POST", "/api/v3/repos/o/r/pulls/2/requested_reviewers", "Bearer t0ken", map[string]interface{}{"reviewers": []interface{}{"octocat"}, "team_reviewers": []interface{}{"gophers"}}},
+		{"POST", "/api/v3/repos/o/r/pulls", "Bearer t0ken", map[string]interface{}{"head": "head", "base": "main", "title": "title", "body": "body"}},
+	}
+	if diff := cmp.Diff(expected, requests); diff != "" {
+		t.Errorf("requests (-want +got):\n%s", diff)
+	}
+}
+
+const releaseHistoryPage = `<h2 id="go1.22.0">go1.22.0 (released 2024-02-06)</h2>
+
+<p>
+Go 1.22.0 is a major release of Go.
+Read the <a href="/doc/go1.22">Go 1.22 Release Notes</a> for more information.
+</p>
+
+<h3 id="go1.22.minor">Minor revisions</h3>
+
+<p id="go1.22.1">
+go1.22.1 (released 2024-03-05) includes security fixes to the <code>crypto/x509</code> and <code>net/http</code> packages, as well as bug fixes to the compiler.
+See the <a href="https://github.com/golang/go/issues?q=milestone%3AGo1.22.1+label%3ACherryPickApproved">Go 1.22.1 milestone</a> on our issue tracker for details.
+</p>
+
+<p id="go1.22.2">
+go1.22.2 (released 2024-04-03) includes bug fixes to the compiler &amp; the runtime.
+See the <a href="https://github.com/golang/go/issues?q=milestone%3AGo1.22.2+label%3ACherryPickApproved">Go 1.22.2 milestone</a> on our issue tracker for details.
+</p>
+
+<h2 id="go1.21.0">go1.21.0 (released 2023-08-08)</h2>
+
+<p id="go1.9.2">
+go1.9.2 (released 2017/10/25) includes fixes to the compiler.
+</p>
+`
+
+func TestChangelog(t *testing.T) {
+	notes := ParseReleaseNotes([]byte(releaseHistoryPage))
+	expectedNotes := []ReleaseNote{
+		{Version: "go1.22.0", Date: "2024-02-06", Summary: "Go 1.22.0 is a major release of Go. Read the Go 1.22 Release Notes for more information."},
+		{Version: "go1.22.1", Date: "2024-03-05", Security: true, Summary: "includes security fixes to the crypto/x509 and net/http packages, as well as bug fixes to the compiler."},
+		{Version: "go1.22.2", Date: "2024-04-03", Summary: "includes bug fixes to the compiler & the runtime."},
+		{Version: "go1.21.0", Date: "2023-08-08", Summary: ""},
+		{Version: "go1.9.2", Date: "2017-10-25", Summary: "includes fixes to the compiler."},
+	}
+	if diff := cmp.Diff(expectedNotes, notes); diff != "" {
+		t.Errorf("ParseReleaseNotes (-want +got):\n%s", diff)
+	}
+
+	releases := []Release{
+		{Version: "go1.22.2", Stable: true},
+		{Version: "go1.22.1", Stable: true},
+		{Version: "go1.22.0", Stable: true},
+		{Version: "go1.21.9", Stable: true},
+		{Version: "go1.21.0", Stable: true},
+	}
+	testCases := []struct {
+		name        string
+		oldVersions []string
+		expected    string
+	}{
+		{
+			name:        "between the oldest old version and the new one",
+			oldVersions: []string{"1.22.0", "1.21.9"},
+			expected: `### Go releases since 1.22.0, 1.21.9
+
+- [Go 1.22.2](https://go.dev/doc/devel/release#go1.22.2) (2024-04-03): includes bug fixes to the compiler & the runtime.
+- [Go 1.22.1](https://go.dev/doc/devel/release#go1.22.1) (2024-03-05) **security release**: includes security fixes to the crypto/x509 and net/http packages, as well as bug fixes to the compiler.
+- [Go 1.22.0](https://go.dev/doc/devel/release#go1.22.0) (2024-02-06): Go 1.22.0 is a major release of Go. Read the Go 1.22 Release Notes for more information.
+`,
+		},
+		{
+			name:        "minor version pins",
+			oldVersions: []string{"1.22"},
+			expected: `### Go releases since 1.22
+
+- [Go 1.22.2](https://go.dev/doc/devel/release#go1.22.2) (2024-04-03): includes bug fixes to the compiler & the runtime.
+- [Go 1.22.1](https://go.dev/doc/devel/release#go1.22.1) (2024-03-05) **security release**: includes security fixes to the crypto/x509 and net/http packages, as well as bug fixes to the compiler.
+`,
+		},
+		{
+			name: "no old versions",
+			expected: `### Go releases since the last update
+
+- [Go 1.22.2](https://go.dev/doc/devel/release#go1.22.2) (2024-04-03): includes bug fixes to the compiler & the runtime.
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			md, err := NewChangelog(releases, notes, nil, tc.oldVersions, "1.22.2").Markdown(DefaultChangelogTemplate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.expected, md); diff != "" {
+				t.Errorf("changelog (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	c := NewChangelog(releases, nil, nil, []string{"1.21.0"}, "1.22.2")
+	if c.Security || len(c.Releases) != 4 {
+		t.Errorf("changelog without release notes: %#v", c)
+	}
+	md, err := c.Markdown("{{range .Releases}}{{.Version}}{{if .Security}}!{{end}} {{end}}")
+	if err != nil || md != "1.22.2 1.22.1 1.22.0 1.21.9 " {
+		t.Errorf("custom changelog template: %#v, %v", md, err)
+	}
+}
+
+func TestVulnDB(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata/vulndb")))
+	defer srv.Close()
+	releases := []Release{
+		{Version: "go1.22.5", Stable: true},
+		{Version: "go1.22.4", Stable: true},
+		{Version: "go1.21.12", Stable: true},
+		{Version: "go1.20.14", Stable: true},
+	}
+	for _, source := range []string{"testdata/vulndb", srv.URL + "/"} {
+		db, err := LoadVulnDB(nil, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testcases := []struct {
+			pinned   string
+			expected []string
+		}{
+			{"1.22.3", []string{"GO-2024-2887", "GO-2024-2963"}},
+			{"1.22.4", []string{"GO-2024-2963"}},
+			{"1.22.5", nil},
+			{"1.20.4", []string{"GO-2024-2887", "GO-2024-2963", "GO-2023-1839"}},
+			{"1.22rc1", []string{"GO-2024-2887", "GO-2024-2963"}},
+			// Minor versions float to their latest patch release.
+			{"1.22", nil},
+			{"1.20", []string{"GO-2024-2887", "GO-2024-2963"}},
+			{"", nil},
+		}
+		for _, tc := range testcases {
+			var actual []string
+			for _, v := range db.Affecting(tc.pinned, releases) {
+				actual = append(actual, v.ID)
+			}
+			if !cmp.Equal(tc.expected, actual) {
+				t.Errorf("%s: vulnerabilities affecting %#v: %s", source, tc.pinned, cmp.Diff(tc.expected, actual))
+			}
+		}
+	}
+	if _, err := LoadVulnDB(nil, srv.URL+"/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("loading a missing database: %v", err)
+	}
+
+	db, err := LoadVulnDB(nil, "testdata/vulndb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := Target{Releases: releases, Policy: PolicySecurity, Precision: PrecisionPreserve, Vulns: db}
+	for old, expected := range map[string]string{"1.22.3": "1.22.5", "1.22.5": "", "1.22": "", "1.21.12": "", "1.20.4": "1.22.5"} {
+		actual, _ := target.Resolve(old)
+		if actual != expected {
+			t.Errorf("security policy updated %#v to %#v instead of %#v", old, actual, expected)
+		}
+	}
+	// Vulnerabilities that no release fixes yet aren't a reason to update.
+	unfixed := &Vuln{}
+	err = json.Unmarshal([]byte(`{"id": "GO-2099-0001", "affected": [{"package": {"name": "stdlib"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]}]}`), unfixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.Vulns = &VulnDB{Vulns: []*Vuln{unfixed}}
+	if actual, ok := target.Resolve("1.21.12"); ok {
+		t.Errorf("security policy updated for an unfixed vulnerability to %#v", actual)
+	}
+	target.Vulns = nil
+	if actual, ok := target.Resolve("1.20.4"); ok {
+		t.Errorf("security policy without a vulnerability database updated to %#v", actual)
+	}
+
+	md, err := NewChangelog(releases, nil, db, []string{"1.22.3", "1.21.12"}, "1.22.5").Markdown(DefaultChangelogTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `### Go releases since 1.22.3, 1.21.12
+
+- [Go 1.22.5](https://go.dev/doc/devel/release#go1.22.5) **security release**
+- [Go 1.22.4](https://go.dev/doc/devel/release#go1.22.4) **security release**
+
+### Vulnerabilities fixed
+
+- [GO-2024-2887](https://pkg.go.dev/vuln/GO-2024-2887) (CVE-2024-24790), fixed in Go 1.22.4: Unexpected behavior from Is methods for IPv4-mapped IPv6 addresses in net/netip
+- [GO-2024-2963](https://pkg.go.dev/vuln/GO-2024-2963) (CVE-2024-24791), fixed in Go 1.22.5: Denial of service due to improper 100-continue handling in net/http
+`
+	if diff := cmp.Diff(expected, md); diff != "" {
+		t.Errorf("changelog with vulnerabilities (-want +got):\n%s", diff)
+	}
+
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.22.0-0", "1.22.0-rc.1", -1},
+		{"1.22.0-rc.1", "1.22.0-rc.2", -1},
+		{"1.22.0-beta.1", "1.22.0-rc.1", -1},
+		{"1.22.0-rc.1", "1.22.0", -1},
+		{"1.21.11", "1.21.2", 1},
+		{"1.21.0", "1.21.0", 0},
+	} {
+		if actual := compareSemver(tc.a, tc.b); actual != tc.expected {
+			t.Errorf("compareSemver(%#v, %#v) = %d, want %d", tc.a, tc.b, actual, tc.expected)
+		}
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var requests []string
+	failures := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		switch {
+		case failures > 0:
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, "releases")
+		}
+	}))
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var sleeps []time.Duration
+	newClient := func(opts HTTPOptions) *HTTPClient {
+		c, err := NewHTTPClient(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+		c.now = func() time.Time { return now }
+		return c
+	}
+	c := newClient(HTTPOptions{Retries: 2, CacheDir: dir, CacheTTL: time.Hour})
+
+	// Server errors are retried with growing delays.
+	failures = 2
+	b, err := c.Get(srv.URL)
+	if err != nil || string(b) != "releases" {
+		t.Fatalf("Get after server errors: %q, %v", b, err)
+	}
+	if len(sleeps) != 2 || sleeps[0] < 250*time.Millisecond || sleeps[0] >= 500*time.Millisecond || sleeps[1] < 500*time.Millisecond || sleeps[1] >= time.Second {
+		t.Errorf("backoff: %v", sleeps)
+	}
+
+	// The cached response's ETag makes the next request conditional.
+	requests = nil
+	b, err = c.Get(srv.URL)
+	if err != nil || string(b) != "releases" {
+		t.Errorf("Get of an unmodified response: %q, %v", b, err)
+	}
+	if !cmp.Equal(requests, []string{`"v1"`}) {
+		t.Errorf("If-None-Match headers: %q", requests)
+	}
+
+	// Errors that aren't the network's or the server's aren't retried.
+	requests = nil
+	if _, err := c.Get(srv.URL + "/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Get of a missing file: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("requests for a missing file: %d", len(requests))
+	}
+
+	// When the network is down, the cached response is used while it's
+	// younger than the TTL.
+	srv.Close()
+	now = now.Add(59 * time.Minute)
+	b, err = c.Get(srv.URL)
+	if err != nil || string(b) != "releases" {
+		t.Errorf("Get while offline: %q, %v", b, err)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, err := c.Get(srv.URL); err == nil {
+		t.Errorf("Get while offline with an expired cache succeeded")
+	}
+
+	// Certificate authorities in the CA bundle are trusted.
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure")
+	}))
+	defer tlsSrv.Close()
+	if _, err := newClient(HTTPOptions{Retries: -1}).Get(tlsSrv.URL); err == nil {
+		t.Errorf("Get of an untrusted server succeeded")
+	}
+	bundle := filepath.Join(dir, "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw})
+	if err := ioutil.WriteFile(bundle, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b, err = newClient(HTTPOptions{CABundle: bundle}).Get(tlsSrv.URL)
+	if err != nil || string(b) != "secure" {
+		t.Errorf("Get with a CA bundle: %q, %v", b, err)
+	}
+	if _, err := NewHTTPClient(HTTPOptions{CABundle: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Errorf("NewHTTPClient with a missing CA bundle succeeded")
+	}
+}
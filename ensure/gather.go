@@ -0,0 +1,154 @@
+package ensure
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileMatch is a file found for a file type, and why it was.
+type FileMatch struct {
+	// Type is the name of the file type.
+	Type string
+	// Path is the slash-separated path of the file relative to the repo's
+	// root.
+	Path string
+	// Reason is the input or default pattern that found the file.
+	Reason string
+	// ExcludedBy is the exclude pattern that excluded the file, if any.
+	ExcludedBy string
+}
+
+// GatherFiles returns the files that the pinner should read: the ones
+// matching patterns if there are any, or the pinner's default patterns if
+// not. input names where patterns came from, like "dockerfiles", for the
+// matches' reasons. repoFiles are the files found by DiscoverFiles. Paths in
+// patterns without any glob metacharacters are returned even if they don't
+// exist so that a typo in them is an error later instead of silently doing
+// nothing. Files that are excluded are returned, too, but marked as such.
+func GatherFiles(u Pinner, repoFiles []string, input string, patterns, excludes GlobList) []FileMatch {
+	reasonFmt := input + " pattern %#v"
+	found := make(map[string]string)
+	if len(patterns) == 0 {
+		patterns = GlobList(u.Patterns())
+		reasonFmt = "default pattern %#v"
+	} else {
+		for _, pattern := range patterns {
+			if isLiteralGlob(pattern) {
+				found[pattern] = fmt.Sprintf(reasonFmt, pattern)
+			}
+		}
+	}
+	for _, fp := range repoFiles {
+		if _, ok := found[fp]; ok {
+			continue
+		}
+		if matched, pattern := patterns.Match(fp); matched {
+			found[fp] = fmt.Sprintf(reasonFmt, pattern)
+		}
+	}
+
+	var matches []FileMatch
+	for fp, reason := range found {
+		m := FileMatch{Type: u.Name(), Path: fp, Reason: reason}
+		if excluded, pattern := excludes.Match(fp); excluded {
+			m.ExcludedBy = pattern
+		}
+		matches = append(matches, m)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Path < matches[j].Path
+	})
+	return matches
+}
+
+// ParseInputPatterns parses a comma-separated list of glob patterns given in
+// an input and normalizes them with NormalizeInputPath.
+func ParseInputPatterns(root, input string) (GlobList, error) {
+	patterns, err := ParseGlobList(input)
+	if err != nil {
+		return nil, err
+	}
+	for i, pattern := range patterns {
+		patterns[i] = NormalizeInputPath(root, pattern)
+	}
+	return patterns, nil
+}
+
+// NormalizeInputPath turns a (possibly negated) path or pattern given in an
+// input into a clean slash-separated one relative to root. Inputs have always
+// been allowed to be written like "./Dockerfile" or as absolute paths.
+func NormalizeInputPath(root, pattern string) string {
+	negation := ""
+	if strings.HasPrefix(pattern, "!") {
+		negation, pattern = "!", pattern[1:]
+	}
+	if filepath.IsAbs(pattern) {
+		if rel, err := filepath.Rel(root, pattern); err == nil {
+			pattern = rel
+		}
+	}
+	return negation + path.Clean(filepath.ToSlash(pattern))
+}
+
+// skippedDirs are the names of directories that are never searched for files
+// to update. They hold other people's code or tools' data and can be huge.
+// Files in them can still be updated by listing them in an input.
+var skippedDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+	"vendor":       true,
+	".terraform":   true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+// DiscoverFiles walks the repo at root once and returns the
+// slash-separated paths, relative to root, of the files that the file types'
+// patterns are matched against. The walk skips the skippedDirs and anything
+// ignored by the repo's .gitignore files or .git/info/exclude. Symlinks are
+// skipped, too: following symlinked directories can loop forever, and writing
+// through a symlinked file could change a file outside of the repo. The
+// files the symlinks point to are found on their own if they're in the repo.
+func DiscoverFiles(root string) ([]string, error) {
+	fsys := os.DirFS(root)
+	ignores := &gitignore{}
+	if err := ignores.load(fsys, ".git/info/exclude", ""); err != nil {
+		return nil, fmt.Errorf("unable to read .git/info/exclude: %s", err)
+	}
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("unable to walk %#v: %s", fp, err)
+		}
+		if d.IsDir() {
+			if fp == "." {
+				return ignores.load(fsys, ".gitignore", "")
+			}
+			if skippedDirs[d.Name()] || ignores.ignored(fp, true) {
+				return fs.SkipDir
+			}
+			return ignores.load(fsys, fp+"/.gitignore", fp)
+		}
+		if !d.Type().IsRegular() || ignores.ignored(fp, false) {
+			return nil
+		}
+		files = append(files, fp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,177 @@
+package ensure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// DefaultBranchTemplate and DefaultCommitMessageTemplate are the templates for
+// the branch and commit message that updates are committed with unless
+// they're overridden. They're text/template templates executed with a
+// TemplateData.
+const (
+	DefaultBranchTemplate        = "ensure-latest-go/patch-{{.GoVersion}}"
+	DefaultCommitMessageTemplate = "update to latest Go release {{.GoVersion}}"
+)
+
+// defaultGitAuthor is who commits are made by in repos without a configured
+// git user, like the checkouts made in GitHub Actions.
+const defaultGitAuthor = "github-actions[bot] <41898282+github-actions[bot]@users.noreply.github.com>"
+
+// TemplateData is what the branch, commit message, and pull request templates
+// are executed with.
+type TemplateData struct {
+	// GoVersion is the version of Go that files were updated to, like
+	// "1.22.3".
+	GoVersion string
+	// OldVersions are the distinct Go versions, like "1.21.5", that the
+	// files were updated from.
+	OldVersions []string
+	// Files are the slash-separated paths, relative to the repo's root, of
+	// the files that were updated.
+	Files []string
+	// Changelog is the markdown listing the releases between the old
+	// versions and GoVersion.
+	Changelog string
+}
+
+// templateFuncs are the functions available to templates on top of
+// text/template's.
+var templateFuncs = template.FuncMap{"join": strings.Join}
+
+// ExecuteTemplate parses the text/template tmpl and executes it with data,
+// which is a TemplateData or a Changelog. Templates can use join, which is
+// strings.Join.
+func ExecuteTemplate(name, tmpl string, data interface{}) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse %s template: %s", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("unable to execute %s template: %s", name, err)
+	}
+	return buf.String(), nil
+}
+
+// GitRepo runs git commands in a local git repository.
+type GitRepo struct {
+	// Dir is a directory in the repository's working tree.
+	Dir string
+}
+
+func (r GitRepo) git(args ...string) (string, error) {
+	// Repos checked out by a different user, like in GitHub Actions'
+	// containers, are refused without safe.directory.
+	args = append([]string{"-c", "safe.directory=*", "-C", r.Dir}, args...)
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), &gitError{args: args[4:], err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout.String(), nil
+}
+
+type gitError struct {
+	args   []string
+	err    error
+	stderr string
+}
+
+func (e *gitError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("git %s failed: %s", strings.Join(e.args, " "), e.err)
+	}
+	return fmt.Sprintf("git %s failed: %s: %s", strings.Join(e.args, " "), e.err, e.stderr)
+}
+
+func (e *gitError) exitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(e.err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// RemoteBranchExists reports whether the branch exists on the remote. Remotes
+// that aren't configured have no branches.
+func (r GitRepo) RemoteBranchExists(remote, branch string) (bool, error) {
+	out, err := r.git("remote")
+	if err != nil {
+		return false, err
+	}
+	if !contains(strings.Fields(out), remote) {
+		return false, nil
+	}
+	_, err = r.git("ls-remote", "--exit-code", "--heads", remote, "refs/heads/"+branch)
+	var gitErr *gitError
+	if errors.As(err, &gitErr) && gitErr.exitCode() == 2 {
+		// --exit-code exits with 2 when no refs matched.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateBranch creates the branch at the current commit and checks it out. It's
+// an error if the branch already exists locally.
+func (r GitRepo) CreateBranch(branch string) error {
+	_, err := r.git("checkout", "-b", branch)
+	return err
+}
+
+// CommitFiles commits exactly the files at the given paths with message. Other
+// changes to the working tree or the index aren't committed. If author, like
+// "A U Thor <author@example.com>", is empty, the repo's configured git user
+// makes the commit, or a GitHub Actions bot if there isn't one.
+func (r GitRepo) CommitFiles(paths []string, message, author string) error {
+	if _, err := r.git(append([]string{"add", "--"}, paths...)...); err != nil {
+		return err
+	}
+	var identity []string
+	if author == "" {
+		if email, _ := r.git("config", "user.email"); strings.TrimSpace(email) == "" {
+			author = defaultGitAuthor
+		}
+	}
+	if author != "" {
+		i := strings.LastIndex(author, " <")
+		if i == -1 || !strings.HasSuffix(author, ">") {
+			return fmt.Errorf("git author %#v is not like \"Name <email>\"", author)
+		}
+		identity = []string{"-c", "user.name=" + author[:i], "-c", "user.email=" + author[i+2:len(author)-1]}
+	}
+	args := append(identity, "commit", "--only", "-m", message, "--")
+	_, err := r.git(append(args, paths...)...)
+	return err
+}
+
+// CurrentBranch returns the name of the branch that's checked out. It's an
+// error if HEAD is detached.
+func (r GitRepo) CurrentBranch() (string, error) {
+	out, err := r.git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Push pushes the branch to the remote.
+func (r GitRepo) Push(remote, branch string) error {
+	_, err := r.git("push", remote, "refs/heads/"+branch+":refs/heads/"+branch)
+	return err
+}
+
+// ForcePush pushes the branch to remoteBranch on the remote, replacing
+// whatever commits remoteBranch had.
+func (r GitRepo) ForcePush(remote, branch, remoteBranch string) error {
+	_, err := r.git("push", "--force", remote, "refs/heads/"+branch+":refs/heads/"+remoteBranch)
+	return err
+}
@@ -0,0 +1,216 @@
+package ensure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultGitHubAPIURL is the base URL of the GitHub REST API on github.com.
+// GitHub Enterprise Server's is like https://github.example.com/api/v3.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// DefaultPullRequestBodyTemplate is the template of the body of pull requests
+// unless it's overridden. Like the branch template, it's executed with a
+// TemplateData.
+const DefaultPullRequestBodyTemplate = `Updates Go{{if .OldVersions}} from {{join .OldVersions ", "}}{{end}} to {{.GoVersion}}.
+
+Updated files:
+{{range .Files}}
+- ` + "`{{.}}`" + `{{end}}
+{{with .Changelog}}
+{{.}}{{end}}`
+
+// pullRequestMarkerRe matches the hidden comment added to the bodies of our
+// pull requests so they can be found again when the next release comes out.
+var pullRequestMarkerRe = regexp.MustCompile(`<!-- ensure-latest-go: (\S+) -->`)
+
+// PullRequestMarker returns the hidden comment that marks a pull request body
+// as ensure-latest-go's update to goVers.
+func PullRequestMarker(goVers string) string {
+	return fmt.Sprintf("<!-- ensure-latest-go: %s -->", goVers)
+}
+
+// GitHub is a client for the parts of the GitHub REST API used to open pull
+// requests.
+type GitHub struct {
+	// BaseURL is the API's base URL. Defaults to DefaultGitHubAPIURL.
+	BaseURL string
+	// Token authenticates the requests, like the GITHUB_TOKEN of a GitHub
+	// Actions workflow.
+	Token string
+	// Client makes the requests. Defaults to a client with a timeout.
+	Client *http.Client
+}
+
+// PullRequest is the part of a GitHub pull request that we use.
+type PullRequest struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// Version returns the Go version that the pull request was ensure-latest-go's
+// update to, and false if it's not one of ours.
+func (pr *PullRequest) Version() (string, bool) {
+	m := pullRequestMarkerRe.FindStringSubmatch(pr.Body)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// FindPullRequest returns the open pull request into the base branch of the
+// repo, like "jmhodges/ensure-latest-go", that ensure-latest-go made for an
+// earlier release, or nil if there isn't one.
+func (g *GitHub) FindPullRequest(repo, base string) (*PullRequest, error) {
+	q := url.Values{"state": {"open"}, "base": {base}, "per_page": {"100"}}
+	next := g.url("/repos/" + repo + "/pulls?" + q.Encode())
+	for next != "" {
+		var prs []*PullRequest
+		resp, err := g.do("GET", next, nil, &prs)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			if _, ok := pr.Version(); ok {
+				return pr, nil
+			}
+		}
+		next = nextPageURL(resp.Header.Get("Link"))
+	}
+	return nil, nil
+}
+
+// CreatePullRequest opens a pull request to merge the head branch into the base
+// branch.
+func (g *GitHub) CreatePullRequest(repo, head, base, title, body string) (*PullRequest, error) {
+	req := map[string]string{"head": head, "base": base, "title": title, "body": body}
+	pr := &PullRequest{}
+	_, err := g.do("POST", g.url("/repos/"+repo+"/pulls"), req, pr)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// UpdatePullRequest changes the title and body of a pull request.
+func (g *GitHub) UpdatePullRequest(repo string, number int, title, body string) (*PullRequest, error) {
+	req := map[string]string{"title": title, "body": body}
+	pr := &PullRequest{}
+	_, err := g.do("PATCH", g.url(fmt.Sprintf("/repos/%s/pulls/%d", repo, number)), req, pr)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// AddLabels adds the labels to a pull request.
+func (g *GitHub) AddLabels(repo string, number int, labels []string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	req := map[string][]string{"labels": labels}
+	_, err := g.do("POST", g.url(fmt.Sprintf("/repos/%s/issues/%d/labels", repo, number)), req, nil)
+	return err
+}
+
+// RequestReviewers requests reviews of a pull request from the reviewers. Teams
+// are given like "org/team-slug" and users by their logins.
+func (g *GitHub) RequestReviewers(repo string, number int, reviewers []string) error {
+	if len(reviewers) == 0 {
+		return nil
+	}
+	req := map[string][]string{"reviewers": {}, "team_reviewers": {}}
+	for _, r := range reviewers {
+		if i := strings.Index(r, "/"); i != -1 {
+			req["team_reviewers"] = append(req["team_reviewers"], r[i+1:])
+		} else {
+			req["reviewers"] = append(req["reviewers"], r)
+		}
+	}
+	_, err := g.do("POST", g.url(fmt.Sprintf("/repos/%s/pulls/%d/requested_reviewers", repo, number)), req, nil)
+	return err
+}
+
+func (g *GitHub) url(path string) string {
+	base := g.BaseURL
+	if base == "" {
+		base = DefaultGitHubAPIURL
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// do makes a request to the API with reqBody, if any, encoded as JSON, and
+// decodes the response's JSON into respBody, if it's not nil.
+func (g *GitHub) do(method, u string, reqBody, respBody interface{}) (*http.Response, error) {
+	var body io.Reader
+	if reqBody != nil {
+		b, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	client := g.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to make GitHub API request %s %s: %s", method, u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// GitHub's errors are JSON with a message.
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		if json.Unmarshal(b, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(b))
+		}
+		return nil, fmt.Errorf("GitHub API request %s %s returned HTTP status code %d: %s", method, u, resp.StatusCode, apiErr.Message)
+	}
+	if respBody != nil {
+		if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
+			return nil, fmt.Errorf("unable to JSON parse GitHub API response to %s %s: %s", method, u, err)
+		}
+	}
+	return resp, nil
+}
+
+var linkNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPageURL returns the URL of the next page of results from a Link header,
+// or the empty string if there isn't one.
+func nextPageURL(link string) string {
+	m := linkNextRe.FindStringSubmatch(link)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,104 @@
+package ensure
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// gitignore holds the rules of the .gitignore files found so far while
+// walking a repo. It implements the parts of gitignore(5) that matter for
+// finding files: negation, directory-only patterns, anchoring, and "**".
+type gitignore struct {
+	rules []gitignoreRule
+}
+
+type gitignoreRule struct {
+	// base is the slash-separated directory, relative to the repo's root,
+	// of the .gitignore file the rule came from. It's empty for the root.
+	base     string
+	pattern  string
+	negated  bool
+	dirOnly  bool
+	anchored bool
+}
+
+// load adds the rules of the gitignore-formatted file at fp, if it exists,
+// with the rules relative to the directory base.
+func (g *gitignore) load(fsys fs.FS, fp, base string) error {
+	b, err := fs.ReadFile(fsys, fp)
+	if err != nil {
+		if isNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, line := range bytes.Split(b, []byte{'\n'}) {
+		if rule, ok := parseGitignoreLine(string(line), base); ok {
+			g.rules = append(g.rules, rule)
+		}
+	}
+	return nil
+}
+
+func parseGitignoreLine(line, base string) (gitignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless they're escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+	rule := gitignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negated = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	// A slash anywhere but the end anchors the pattern to the directory of
+	// its .gitignore. Otherwise, it matches a name at any depth.
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return gitignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// ignored reports whether the slash-separated path relPath, relative to the
+// repo's root, is ignored. Like git, the last matching rule wins.
+func (g *gitignore) ignored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel := relPath
+		if rule.base != "" {
+			if !strings.HasPrefix(relPath, rule.base+"/") {
+				continue
+			}
+			rel = relPath[len(rule.base)+1:]
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchGlob(rule.pattern, rel)
+		} else {
+			matched, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+		if matched {
+			ignored = !rule.negated
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,107 @@
+package ensure
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// matchGlob reports whether the slash-separated path name matches pattern. The
+// pattern syntax is path.Match's plus "**", which matches zero or more whole
+// path segments. So, "services/**/Dockerfile" matches "services/Dockerfile"
+// and "services/a/b/Dockerfile", and "legacy/**" matches everything in
+// legacy/.
+func matchGlob(pattern, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// validateGlob returns an error if pattern is malformed.
+func validateGlob(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty glob pattern")
+	}
+	for _, seg := range strings.Split(pattern, "/") {
+		if seg == "**" {
+			continue
+		}
+		if strings.Contains(seg, "**") {
+			return fmt.Errorf("glob pattern %#v uses ** inside of a path segment instead of as a whole one", pattern)
+		}
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("malformed glob pattern %#v: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// GlobList is an ordered list of glob patterns, any of which can be negated
+// with a leading "!". A path matches the list if the last pattern in it that
+// matches the path isn't negated, so "legacy/**,!legacy/keep/**" matches
+// everything in legacy/ except legacy/keep/. A list that starts with a
+// negated pattern starts out matching everything, so "!legacy/**" alone
+// matches everything outside of legacy/.
+type GlobList []string
+
+// ParseGlobList parses a comma-separated list of glob patterns, like those
+// used in the GitHub Action's inputs.
+func ParseGlobList(s string) (GlobList, error) {
+	var gl GlobList
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if err := validateGlob(strings.TrimPrefix(pattern, "!")); err != nil {
+			return nil, err
+		}
+		gl = append(gl, pattern)
+	}
+	return gl, nil
+}
+
+// Match reports whether relPath, a slash-separated path relative to the repo's
+// root, matches the list, and returns the pattern that decided it. The
+// pattern is empty if no pattern matched, and "**" if the path matched
+// because the list starts with a negated pattern.
+func (gl GlobList) Match(relPath string) (bool, string) {
+	matched := len(gl) > 0 && strings.HasPrefix(gl[0], "!")
+	decider := ""
+	if matched {
+		decider = "**"
+	}
+	for _, pattern := range gl {
+		negated := strings.HasPrefix(pattern, "!")
+		if matchGlob(strings.TrimPrefix(pattern, "!"), relPath) {
+			matched, decider = !negated, pattern
+		}
+	}
+	return matched, decider
+}
+
+// isLiteralGlob reports whether pattern has no glob metacharacters in it and
+// so can only match the path it spells out.
+func isLiteralGlob(pattern string) bool {
+	return !strings.ContainsAny(pattern, `*?[\!`)
+}
@@ -0,0 +1,37 @@
+package ensure
+
+import (
+	"regexp"
+)
+
+// goModToolchainRe and goModGoRe match go.mod's toolchain and go directives.
+// The toolchain directive names the Go release the module is meant to be
+// built with and the go directive the minimum version of the language.
+var (
+	goModToolchainRe = regexp.MustCompile(`(?m)^[ \t]*toolchain[ \t]+go(\d+\.\d+(?:\.\d+)?(?:[a-z]+\d*)?)[ \t]*(?://.*)?\r?$`)
+	goModGoRe        = regexp.MustCompile(`(?m)^[ \t]*go[ \t]+(\d+\.\d+(?:\.\d+)?(?:[a-z]+\d*)?)[ \t]*(?://.*)?\r?$`)
+)
+
+// GoModPinner finds the Go version that a go.mod file builds with. It's only
+// a Pinner because go.mod files' versions say which Go versions the module
+// supports and are for the module's authors to bump, not this tool, but
+// they're the files that the others in a repo usually ought to agree with.
+type GoModPinner struct{}
+
+func (GoModPinner) Name() string        { return "gomod" }
+func (GoModPinner) Description() string { return "go.mod file" }
+func (GoModPinner) Patterns() []string  { return []string{"**/go.mod"} }
+
+// Pins returns the go.mod file's toolchain version or, if it doesn't have a
+// toolchain directive, its go version, since that's the toolchain the go
+// command uses for it then.
+func (GoModPinner) Pins(fp string, contents []byte) ([]Pin, error) {
+	m := goModToolchainRe.FindSubmatchIndex(contents)
+	if m == nil {
+		m = goModGoRe.FindSubmatchIndex(contents)
+	}
+	if m == nil {
+		return nil, nil
+	}
+	return []Pin{{string(contents[m[2]:m[3]]), m[2], m[3]}}, nil
+}
@@ -0,0 +1,98 @@
+package ensure
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// GOTOOLCHAIN settings pick the toolchain that the go command runs, like
+//
+//	ENV GOTOOLCHAIN=go1.21.5
+//	GOTOOLCHAIN: go1.21.5+auto
+//	go env -w GOTOOLCHAIN=go1.21.5+path
+//
+// Only the settings that name a toolchain's version are pins. "local", "auto",
+// and "path" don't name one and are left alone, and the "+auto" or "+path"
+// suffix of the ones that do is kept as it is.
+
+// goToolchainRe matches a GOTOOLCHAIN setting with an explicit version, as an
+// environment variable assignment, a YAML key, or the old "ENV name value"
+// form of Dockerfiles. The first group is the version and the second the
+// suffix, if any.
+var goToolchainRe = regexp.MustCompile(`\bGOTOOLCHAIN["']?(?:[ \t]*[=:][ \t]*|[ \t]+)["']?go(\d+\.\d+(?:\.\d+)?(?:(?:rc|beta)\d+)?)(\+auto|\+path)?`)
+
+// goToolchainPins returns the pins of the versions of the GOTOOLCHAIN
+// settings in contents.
+func goToolchainPins(contents []byte) []Pin {
+	var pins []Pin
+	for _, m := range goToolchainRe.FindAllSubmatchIndex(contents, -1) {
+		// Versions glued to more text, like "go1.21.5-custom", aren't
+		// toolchains that can be updated.
+		if m[1] < len(contents) && isGoToolchainChar(contents[m[1]]) {
+			continue
+		}
+		pins = append(pins, Pin{string(contents[m[2]:m[3]]), m[2], m[3]})
+	}
+	return pins
+}
+
+func isGoToolchainChar(c byte) bool {
+	return c == '_' || c == '.' || c == '+' || c == '-' ||
+		'0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// GoToolchainUpdater updates the GOTOOLCHAIN settings in GitHub Actions
+// workflows' env blocks, direnv's .envrc files, and the go env -w calls and
+// exports of shell scripts and Makefiles. Settings that are commented out are
+// left alone. The ones in Dockerfiles are updated by DockerfileUpdater.
+type GoToolchainUpdater struct{}
+
+func (GoToolchainUpdater) Name() string        { return "gotoolchain" }
+func (GoToolchainUpdater) Description() string { return "GOTOOLCHAIN file" }
+
+// Patterns are the usual homes of GOTOOLCHAIN settings. Files without one are
+// left alone, so they don't need to be more specific.
+func (GoToolchainUpdater) Patterns() []string {
+	return []string{".github/workflows/*.yml", ".github/workflows/*.yaml", "**/.envrc", "Makefile", "*.mk", "*.sh", "scripts/*.sh"}
+}
+
+func (GoToolchainUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	if !bytes.Contains(contents, []byte("GOTOOLCHAIN")) {
+		return nil, nil
+	}
+	var pins []Pin
+	for _, p := range goToolchainPins(contents) {
+		if !inHashComment(contents, p.Start) {
+			pins = append(pins, p)
+		}
+	}
+	return pins, nil
+}
+
+// inHashComment reports whether the byte offset in contents is in a comment
+// that starts with a "#" at the start of a line or after a space, the way
+// comments are written in shell scripts, Makefiles, and YAML.
+func inHashComment(contents []byte, offset int) bool {
+	line := contents[bytes.LastIndexByte(contents[:offset], '\n')+1 : offset]
+	for i, c := range line {
+		if c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePin resolves the pins to the full versions they're updated to, since
+// the go command only downloads toolchains by their full release names, like
+// go1.21.0.
+func (GoToolchainUpdater) ResolvePin(contents []byte, p Pin, t Target) (string, bool) {
+	return resolveFullVersion(p.Version, t)
+}
+
+func (u GoToolchainUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return fullVersionEdits(pins, t), nil
+}
@@ -0,0 +1,171 @@
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// hcl.go is a tokenizer for the HCL files docker buildx bake reads, like
+// docker-bake.hcl. It's only as smart as it needs to be to find blocks,
+// attributes, and the string literals assigned to them. Strings aren't
+// unescaped so that their tokens' text is exactly what's in the source.
+
+type hclTokenKind int
+
+const (
+	hclIdent hclTokenKind = iota
+	hclString
+	hclNumber
+	hclPunct
+	// hclHeredoc is a heredoc, like <<EOT. Its text is left empty since
+	// nothing we look for is ever in one.
+	hclHeredoc
+)
+
+type hclToken struct {
+	kind hclTokenKind
+	// start and end are the byte offsets of the token in the source. For
+	// strings, they include the quotes.
+	start, end int
+	// text is the source text of the token, without the quotes of strings.
+	text string
+	// template is set for strings with interpolations or directives, like
+	// "${GO_VERSION}", whose text isn't their value.
+	template bool
+}
+
+func (t hclToken) is(kind hclTokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func tokenizeHCL(src []byte) ([]hclToken, error) {
+	var toks []hclToken
+	pos := 0
+	for pos < len(src) {
+		c := src[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			pos++
+		case c == '\n':
+			toks = append(toks, hclToken{kind: hclPunct, start: pos, end: pos + 1, text: "\n"})
+			pos++
+		case c == '#' || bytes.HasPrefix(src[pos:], []byte("//")):
+			end := bytes.IndexByte(src[pos:], '\n')
+			if end == -1 {
+				pos = len(src)
+			} else {
+				pos += end
+			}
+		case bytes.HasPrefix(src[pos:], []byte("/*")):
+			end := bytes.Index(src[pos+2:], []byte("*/"))
+			if end == -1 {
+				return nil, fmt.Errorf("line %d: unterminated comment", hclLine(src, pos))
+			}
+			pos += 2 + end + 2
+		case c == '"':
+			tok, err := lexHCLString(src, pos)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, tok)
+			pos = tok.end
+		case bytes.HasPrefix(src[pos:], []byte("<<")) && pos+2 < len(src) && (src[pos+2] == '-' || isIdentStart(src[pos+2])):
+			tok, err := lexHCLHeredoc(src, pos)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, tok)
+			pos = tok.end
+		case isIdentStart(c):
+			start := pos
+			for pos < len(src) && (isIdentStart(src[pos]) || isDigit(src[pos]) || src[pos] == '-') {
+				pos++
+			}
+			toks = append(toks, hclToken{kind: hclIdent, start: start, end: pos, text: string(src[start:pos])})
+		case isDigit(c):
+			start := pos
+			for pos < len(src) && (isDigit(src[pos]) || src[pos] == '.' || src[pos] == 'e' || src[pos] == 'E') {
+				pos++
+			}
+			toks = append(toks, hclToken{kind: hclNumber, start: start, end: pos, text: string(src[start:pos])})
+		default:
+			toks = append(toks, hclToken{kind: hclPunct, start: pos, end: pos + 1, text: string(c)})
+			pos++
+		}
+	}
+	return toks, nil
+}
+
+// lexHCLString lexes the quoted string starting at start. Interpolations can
+// have strings of their own inside of them, like "${join(",", tags)}", so
+// they're skipped as a whole.
+func lexHCLString(src []byte, start int) (hclToken, error) {
+	pos := start + 1
+	template := false
+	depth := 0
+	for {
+		if pos >= len(src) || src[pos] == '\n' && depth == 0 {
+			return hclToken{}, fmt.Errorf("line %d: unterminated string", hclLine(src, start))
+		}
+		c := src[pos]
+		switch {
+		case c == '\\':
+			pos += 2
+			continue
+		case (c == '$' || c == '%') && pos+1 < len(src) && src[pos+1] == '{':
+			if src[pos-1] == c {
+				// "$${" and "%%{" are escapes for a literal "${" and "%{".
+				pos += 2
+				continue
+			}
+			template = true
+			depth++
+			pos += 2
+			continue
+		case c == '}' && depth > 0:
+			depth--
+		case c == '"' && depth > 0:
+			tok, err := lexHCLString(src, pos)
+			if err != nil {
+				return hclToken{}, err
+			}
+			pos = tok.end
+			continue
+		case c == '"':
+			return hclToken{kind: hclString, start: start, end: pos + 1, text: string(src[start+1 : pos]), template: template}, nil
+		}
+		pos++
+	}
+}
+
+// lexHCLHeredoc lexes the heredoc starting at start, like <<EOT or <<-EOT, up
+// to the end of its closing line.
+func lexHCLHeredoc(src []byte, start int) (hclToken, error) {
+	pos := start + 2
+	if src[pos] == '-' {
+		pos++
+	}
+	nameStart := pos
+	for pos < len(src) && (isIdentStart(src[pos]) || isDigit(src[pos])) {
+		pos++
+	}
+	name := string(src[nameStart:pos])
+	for {
+		nl := bytes.IndexByte(src[pos:], '\n')
+		if nl == -1 {
+			return hclToken{}, fmt.Errorf("line %d: unterminated heredoc %s", hclLine(src, start), name)
+		}
+		pos += nl + 1
+		end := bytes.IndexByte(src[pos:], '\n')
+		if end == -1 {
+			end = len(src) - pos
+		}
+		if string(bytes.TrimSpace(src[pos:pos+end])) == name {
+			return hclToken{kind: hclHeredoc, start: start, end: pos + end}, nil
+		}
+	}
+}
+
+func hclLine(src []byte, pos int) int {
+	return bytes.Count(src[:pos], []byte{'\n'}) + 1
+}
@@ -0,0 +1,285 @@
+package ensure
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The defaults of HTTPOptions.
+const (
+	DefaultHTTPTimeout = 10 * time.Second
+	DefaultHTTPRetries = 3
+	DefaultCacheTTL    = 24 * time.Hour
+)
+
+// HTTPOptions configure an HTTPClient.
+type HTTPOptions struct {
+	// Timeout is how long each attempt at a request can take. Zero means
+	// DefaultHTTPTimeout.
+	Timeout time.Duration
+	// Retries is how many times a request that failed because of the
+	// network, a 429, or a 5xx is retried. Negative means no retries.
+	Retries int
+	// CacheDir is the directory responses are cached in. Cached responses
+	// make requests conditional on the response having changed and are
+	// used when the network is down. Empty means nothing is cached.
+	CacheDir string
+	// CacheTTL is how old a cached response can be and still be used when
+	// the network is down. Zero means DefaultCacheTTL.
+	CacheTTL time.Duration
+	// CABundle is the path of a PEM file of certificate authorities to trust
+	// on top of the system's, like the one of a TLS-intercepting proxy.
+	CABundle string
+	// Logf, if set, is told about retries and about cached responses being
+	// used because of failures.
+	Logf func(format string, args ...interface{})
+}
+
+// HTTPClient gets the Go release list, release history, and vulnerability
+// database. A nil *HTTPClient is one with the default options and no cache.
+// Proxies are set with the usual HTTPS_PROXY and NO_PROXY environment
+// variables.
+type HTTPClient struct {
+	opts   HTTPOptions
+	client *http.Client
+	// sleep and now are swapped out in tests.
+	sleep func(time.Duration)
+	now   func() time.Time
+	// rand is the client's own source of jitter. The global one starts from
+	// the same seed in every process before Go 1.20, which would have every
+	// runner wait the same delays.
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// NewHTTPClient returns an HTTPClient with the given options.
+func NewHTTPClient(opts HTTPOptions) (*HTTPClient, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultHTTPTimeout
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.CABundle != "" {
+		pem, err := ioutil.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle %#v: %s", opts.CABundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA bundle %#v", opts.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &HTTPClient{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout, Transport: transport},
+		sleep:  time.Sleep,
+		now:    time.Now,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// defaultHTTPClient is what a nil *HTTPClient uses.
+var defaultHTTPClient, _ = NewHTTPClient(HTTPOptions{Retries: DefaultHTTPRetries})
+
+// Client returns the underlying *http.Client, with its timeout and CA bundle,
+// for requests that shouldn't be retried or cached, like the GitHub API's.
+func (c *HTTPClient) Client() *http.Client {
+	if c == nil {
+		c = defaultHTTPClient
+	}
+	return c.client
+}
+
+// cachedResponse is a response in the cache directory.
+type cachedResponse struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Body         []byte    `json:"body"`
+}
+
+// retryableError is a failed attempt that's worth trying again and, if it
+// keeps failing, falling back to the cache for.
+type retryableError struct {
+	err error
+	// retryAfter is how long the server asked to be left alone for, if it
+	// did.
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+
+// Get returns the body of a successful GET of u. Failures because of the
+// network, 429s, and 5xxs are retried with exponential backoff and jitter,
+// and if they keep failing, a cached response younger than the cache TTL is
+// returned instead.
+func (c *HTTPClient) Get(u string) ([]byte, error) {
+	if c == nil {
+		c = defaultHTTPClient
+	}
+	cached := c.readCache(u)
+	var err error
+	for attempt := 0; ; attempt++ {
+		var body []byte
+		body, err = c.get(u, cached)
+		if err == nil {
+			return body, nil
+		}
+		re, ok := err.(*retryableError)
+		if !ok {
+			return nil, err
+		}
+		if attempt >= c.opts.Retries {
+			break
+		}
+		delay := c.backoff(attempt)
+		if re.retryAfter > delay {
+			delay = re.retryAfter
+		}
+		c.logf("retrying %s in %s: %s", u, delay.Round(time.Millisecond), err)
+		c.sleep(delay)
+	}
+	if cached != nil && c.now().Sub(cached.Fetched) < c.opts.CacheTTL {
+		c.logf("using the response to %s cached at %s: %s", u, cached.Fetched.Format(time.RFC3339), err)
+		return cached.Body, nil
+	}
+	return nil, err
+}
+
+// get makes one attempt at a GET of u, conditional on it having changed since
+// cached if it's not nil.
+func (c *HTTPClient) get(u string, cached *cachedResponse) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		cached.Fetched = c.now()
+		c.writeCache(cached)
+		return cached.Body, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		err := fmt.Errorf("%s returned HTTP status code %d instead of a 200", u, resp.StatusCode)
+		return nil, &retryableError{err: err, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s returned HTTP status code %d instead of a 200", u, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &retryableError{err: fmt.Errorf("unable to read the response from %s: %s", u, err)}
+	}
+	c.writeCache(&cachedResponse{
+		URL:          u,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      c.now(),
+		Body:         body,
+	})
+	return body, nil
+}
+
+// backoff returns how long to wait before retrying after the given failed
+// attempt, counting from 0. It doubles with each attempt, starting at half a
+// second, and is spread over the upper half of that so that many runners
+// failing at once don't all retry at once.
+func (c *HTTPClient) backoff(attempt int) time.Duration {
+	if attempt > 6 {
+		attempt = 6
+	}
+	d := 500 * time.Millisecond << uint(attempt)
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+	return d/2 + time.Duration(c.rand.Int63n(int64(d/2)))
+}
+
+// parseRetryAfter parses the seconds form of a Retry-After header. It's zero
+// for anything else.
+func parseRetryAfter(s string) time.Duration {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0
+	}
+	// Servers asking for long waits are better served by the cache.
+	if n > 60 {
+		n = 60
+	}
+	return time.Duration(n) * time.Second
+}
+
+func (c *HTTPClient) cachePath(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return filepath.Join(c.opts.CacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCache returns the cached response to u, or nil if there isn't a usable
+// one.
+func (c *HTTPClient) readCache(u string) *cachedResponse {
+	if c.opts.CacheDir == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(c.cachePath(u))
+	if err != nil {
+		return nil
+	}
+	cr := &cachedResponse{}
+	if err := json.Unmarshal(b, cr); err != nil || cr.URL != u {
+		return nil
+	}
+	return cr
+}
+
+// writeCache saves the response. The cache is only an optimization, so
+// failing to write it is only logged.
+func (c *HTTPClient) writeCache(cr *cachedResponse) {
+	if c.opts.CacheDir == "" {
+		return
+	}
+	b, err := json.Marshal(cr)
+	if err == nil {
+		err = os.MkdirAll(c.opts.CacheDir, 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(c.cachePath(cr.URL), b, 0644)
+	}
+	if err != nil {
+		c.logf("unable to cache the response to %s: %s", cr.URL, err)
+	}
+}
+
+func (c *HTTPClient) logf(format string, args ...interface{}) {
+	if c.opts.Logf != nil {
+		c.opts.Logf(format, args...)
+	}
+}
@@ -0,0 +1,234 @@
+package ensure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonc.go is a small parser for JSON with comments and trailing commas (the
+// "JSONC" used by VS Code's config files). It keeps the byte offsets of every
+// value so that callers can edit single values in place without re-encoding,
+// and so losing, the rest of the file.
+
+type jsoncKind int
+
+const (
+	jsoncObject jsoncKind = iota
+	jsoncArray
+	jsoncString
+	jsoncLiteral // numbers, true, false, and null
+)
+
+type jsoncValue struct {
+	kind jsoncKind
+	// start and end are the byte offsets of the value in the parsed source.
+	// For strings, they include the quotes.
+	start, end int
+	// str is the decoded value of a string.
+	str     string
+	members []jsoncMember
+	elems   []*jsoncValue
+}
+
+type jsoncMember struct {
+	key   string
+	value *jsoncValue
+}
+
+// member returns the value of the object member with the given key, or nil if
+// v is not an object or has no such member.
+func (v *jsoncValue) member(key string) *jsoncValue {
+	if v == nil || v.kind != jsoncObject {
+		return nil
+	}
+	for _, m := range v.members {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+func parseJSONC(b []byte) (*jsoncValue, error) {
+	p := &jsoncParser{src: b}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.src) {
+		return nil, p.errorf("unexpected %q after top-level value", p.src[p.pos])
+	}
+	return v, nil
+}
+
+type jsoncParser struct {
+	src []byte
+	pos int
+}
+
+func (p *jsoncParser) errorf(format string, args ...interface{}) error {
+	line := bytes.Count(p.src[:p.pos], []byte{'\n'}) + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip moves past any whitespace and comments.
+func (p *jsoncParser) skip() error {
+	for p.pos < len(p.src) {
+		switch {
+		case isJSONSpace(p.src[p.pos]):
+			p.pos++
+		case bytes.HasPrefix(p.src[p.pos:], []byte("//")):
+			end := bytes.IndexByte(p.src[p.pos:], '\n')
+			if end == -1 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 1
+			}
+		case bytes.HasPrefix(p.src[p.pos:], []byte("/*")):
+			end := bytes.Index(p.src[p.pos+2:], []byte("*/"))
+			if end == -1 {
+				return p.errorf("unterminated block comment")
+			}
+			p.pos += 2 + end + 2
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func (p *jsoncParser) value() (*jsoncValue, error) {
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	switch p.src[p.pos] {
+	case '{':
+		return p.object()
+	case '[':
+		return p.array()
+	case '"':
+		return p.string()
+	}
+	start := p.pos
+	for p.pos < len(p.src) && !isJSONSpace(p.src[p.pos]) && bytes.IndexByte([]byte(",:{}[]\"/"), p.src[p.pos]) == -1 {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return &jsoncValue{kind: jsoncLiteral, start: start, end: p.pos}, nil
+}
+
+func (p *jsoncParser) string() (*jsoncValue, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) && p.src[p.pos] != '"' {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unterminated string")
+	}
+	p.pos++
+	v := &jsoncValue{kind: jsoncString, start: start, end: p.pos}
+	if err := json.Unmarshal(p.src[start:p.pos], &v.str); err != nil {
+		return nil, p.errorf("invalid string: %s", err)
+	}
+	return v, nil
+}
+
+func (p *jsoncParser) object() (*jsoncValue, error) {
+	v := &jsoncValue{kind: jsoncObject, start: p.pos}
+	p.pos++
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated object")
+		}
+		if p.src[p.pos] == '}' {
+			p.pos++
+			v.end = p.pos
+			return v, nil
+		}
+		if p.src[p.pos] != '"' {
+			return nil, p.errorf("expected object key, found %q", p.src[p.pos])
+		}
+		key, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != ':' {
+			return nil, p.errorf("expected ':' after object key %#v", key.str)
+		}
+		p.pos++
+		val, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		v.members = append(v.members, jsoncMember{key: key.str, value: val})
+		if err := p.comma('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *jsoncParser) array() (*jsoncValue, error) {
+	v := &jsoncValue{kind: jsoncArray, start: p.pos}
+	p.pos++
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.src[p.pos] == ']' {
+			p.pos++
+			v.end = p.pos
+			return v, nil
+		}
+		elem, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		v.elems = append(v.elems, elem)
+		if err := p.comma(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// comma moves past the comma after an object member or array element. A
+// missing comma is only allowed before the closing delimiter, and a comma is
+// allowed before it, too.
+func (p *jsoncParser) comma(closing byte) error {
+	if err := p.skip(); err != nil {
+		return err
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == ',' {
+		p.pos++
+		return nil
+	}
+	if p.pos < len(p.src) && p.src[p.pos] == closing {
+		return nil
+	}
+	return p.errorf("expected ',' or %q", closing)
+}
@@ -0,0 +1,62 @@
+package ensure
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// versionMarker is the text that marks a line of any kind of file as holding a
+// Go version that should be updated. It's usually put in a comment at the end
+// of the line, like
+//
+//	GO_VERSION ?= 1.21.5 # ensure-latest-go: version
+var versionMarker = []byte("ensure-latest-go: version")
+
+// markerGoVersionRe matches a Go version, optionally prefixed with "go" like in
+// release archive names. The version can't be glued to the end of a word so
+// that things like the "3.18" in "alpine3.18" aren't matched.
+var markerGoVersionRe = regexp.MustCompile(`(?:^|[^\w.])(?:go)?(\d+\.\d+(?:\.\d+)?(?:(?:rc|beta)\d+)?)(?:$|[^\w.]|\.[^\d])`)
+
+// MarkerUpdater updates the first Go version before the version marker on
+// every line that has one. Lines without a marker are left alone.
+type MarkerUpdater struct{}
+
+func (MarkerUpdater) Name() string        { return "marker" }
+func (MarkerUpdater) Description() string { return "marked file" }
+
+// Patterns are the usual homes of Go version pins in files without a fixed
+// format. Files without a marker in them are left alone, so they don't need
+// to be more specific.
+func (MarkerUpdater) Patterns() []string {
+	return []string{"Makefile", "*.mk", "*.sh", "scripts/*.sh", "Taskfile.yml", "Taskfile.yaml", "justfile", "Justfile", ".justfile"}
+}
+
+func (MarkerUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	if !bytes.Contains(contents, versionMarker) {
+		return nil, nil
+	}
+	var pins []Pin
+	lineStart := 0
+	for _, line := range bytes.Split(contents, []byte{'\n'}) {
+		offset := lineStart
+		lineStart += len(line) + 1
+		markerInd := bytes.Index(line, versionMarker)
+		if markerInd == -1 {
+			continue
+		}
+		m := markerGoVersionRe.FindSubmatchIndex(line[:markerInd])
+		if m == nil {
+			continue
+		}
+		pins = append(pins, Pin{string(line[m[2]:m[3]]), offset + m[2], offset + m[3]})
+	}
+	return pins, nil
+}
+
+func (u MarkerUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, nil), nil
+}
@@ -0,0 +1,517 @@
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/jmhodges/yaml.v2"
+)
+
+func findMapItemAsMapSlice(obj yaml.MapSlice, desiredKey string) (int, yaml.MapSlice, error) {
+	i, out, err := findMapItem(obj, desiredKey)
+	if err != nil {
+		return i, yaml.MapSlice{}, err
+	}
+	if i == -1 {
+		return i, yaml.MapSlice{}, err
+	}
+	ret, ok := out.(yaml.MapSlice)
+	if !ok {
+		return i, yaml.MapSlice{}, fmt.Errorf("value of %#v in YAML object was not the expected yaml.MapSlice type", desiredKey)
+	}
+	return i, ret, nil
+
+}
+
+func findMapItemAsMapSliceSlice(obj yaml.MapSlice, desiredKey string) (int, []yaml.MapSlice, error) {
+	i, mid, err := findMapItem(obj, desiredKey)
+	if err != nil {
+		return i, nil, err
+	}
+	if i == -1 {
+		return i, nil, err
+	}
+	out, ok := mid.([]interface{})
+	if !ok {
+		return i, nil, fmt.Errorf("value of %#v in YAML object was not the expected []yaml.MapSlice type", desiredKey)
+	}
+	ret := make([]yaml.MapSlice, 0, len(out))
+	for _, x := range out {
+		str, ok := x.(yaml.MapSlice)
+		if !ok {
+			return i, nil, fmt.Errorf("value of %#v in YAML object was not the expected []yaml.MapSlice type", desiredKey)
+		}
+		ret = append(ret, str)
+	}
+	return i, ret, nil
+
+}
+
+func findMapItemAsStringSlice(obj yaml.MapSlice, desiredKey string) (int, []string, error) {
+	i, mid, err := findMapItem(obj, desiredKey)
+	if err != nil {
+		return i, nil, err
+	}
+	if i == -1 {
+		return i, nil, err
+	}
+	out, ok := mid.([]interface{})
+	if !ok {
+		return i, nil, fmt.Errorf("value of %#v in YAML object was not the expected []string type", desiredKey)
+	}
+	ret := make([]string, 0, len(out))
+	for _, x := range out {
+		str, ok := x.(string)
+		if !ok {
+			return i, nil, fmt.Errorf("value of %#v in YAML object was not the expected []string type", desiredKey)
+		}
+		ret = append(ret, str)
+	}
+	return i, ret, nil
+}
+
+func findMapItemAsString(obj yaml.MapSlice, desiredKey string) (int, string, error) {
+	i, out, err := findMapItem(obj, desiredKey)
+	if err != nil {
+		return i, "", err
+	}
+	if i == -1 {
+		return i, "", err
+	}
+	ret, ok := out.(string)
+	if !ok {
+		return i, "", fmt.Errorf("value of %#v in YAML object was not the expected string type", desiredKey)
+	}
+	return i, ret, nil
+
+}
+
+func findMapItem(obj yaml.MapSlice, desiredKey string) (int, interface{}, error) {
+	for i, item := range obj {
+		k, ok := item.Key.(string)
+		if !ok {
+			return -1, nil, fmt.Errorf("non-string key found in YAML object")
+		}
+		if k == desiredKey {
+			return i, item.Value, nil
+		}
+	}
+	return -1, nil, nil
+}
+
+// walkMapSlices calls fn on obj, if it's a yaml.MapSlice, and on every
+// yaml.MapSlice nested inside of it. fn may modify the values of the
+// yaml.MapSlice it's given in place. walkMapSlices returns true if any call to
+// fn returned true.
+func walkMapSlices(obj interface{}, fn func(yaml.MapSlice) bool) bool {
+	var changed bool
+	switch o := obj.(type) {
+	case yaml.MapSlice:
+		if fn(o) {
+			changed = true
+		}
+		for _, item := range o {
+			if walkMapSlices(item.Value, fn) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, x := range o {
+			if walkMapSlices(x, fn) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func yamlMarshal(obj yaml.MapSlice) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetLineLength(-1) // Disable line wrap
+	err := enc.Encode(obj)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlLineNumbers maps the paths of the keys and sequence items in a
+// block-style YAML document, like "rules[1].policy", to the 1-indexed line
+// they start on. It exists because the yaml package doesn't tell us where the
+// values it decodes came from, which we need for useful validation errors.
+// Flow-style collections aren't descended into, so their elements are only
+// found by the path of the collection itself.
+func yamlLineNumbers(src []byte) map[string]int {
+	type container struct {
+		indent int
+		path   string
+		seq    bool
+		// items is the number of items seen so far in a sequence.
+		items int
+	}
+	lines := make(map[string]int)
+	stack := []*container{{indent: -1}}
+	// pending is the path of a key whose value is a block on the following
+	// lines, and pendingIndent is the key's indentation.
+	pending, pendingIndent := "", -1
+
+	for i, rawLine := range strings.Split(string(src), "\n") {
+		line := stripYAMLComment(strings.TrimRight(rawLine, "\r"))
+		content := strings.TrimLeft(line, " ")
+		if strings.TrimSpace(content) == "" || content == "---" {
+			continue
+		}
+		indent := len(line) - len(content)
+		isItem := content == "-" || strings.HasPrefix(content, "- ")
+
+		for len(stack) > 1 {
+			top := stack[len(stack)-1]
+			// A sequence can be at the same indentation as the key it's
+			// the value of, so it only ends at that indentation if the line
+			// isn't another one of its items.
+			if top.indent > indent || (top.indent == indent && top.seq && !isItem) {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			break
+		}
+		top := stack[len(stack)-1]
+
+		if isItem {
+			if !top.seq || top.indent != indent {
+				path := pending
+				if pendingIndent > indent || (pendingIndent == -1 && path == "") {
+					path = top.path
+				}
+				top = &container{indent: indent, path: path, seq: true}
+				stack = append(stack, top)
+			}
+			pending, pendingIndent = "", -1
+			itemPath := fmt.Sprintf("%s[%d]", top.path, top.items)
+			top.items++
+			lines[itemPath] = i + 1
+			rest := strings.TrimLeft(strings.TrimPrefix(content, "-"), " ")
+			if rest == "" {
+				pending, pendingIndent = itemPath, indent
+				continue
+			}
+			// An item that starts with a key is a mapping whose keys are
+			// lined up with that first one.
+			keyIndent := indent + len(content) - len(rest)
+			item := &container{indent: keyIndent, path: itemPath}
+			stack = append(stack, item)
+			content, indent, top = rest, keyIndent, item
+		}
+
+		colon := yamlKeyEnd(content)
+		if colon == -1 {
+			pending, pendingIndent = "", -1
+			continue
+		}
+		if top.seq || top.indent != indent {
+			path := top.path
+			if pending != "" && pendingIndent < indent {
+				path = pending
+			}
+			top = &container{indent: indent, path: path}
+			stack = append(stack, top)
+		}
+		key := strings.Trim(strings.TrimSpace(content[:colon]), `"'`)
+		keyPath := key
+		if top.path != "" {
+			keyPath = top.path + "." + key
+		}
+		lines[keyPath] = i + 1
+		pending, pendingIndent = "", -1
+		// A value that's only an anchor or a tag, like "step: &build",
+		// is a block on the following lines, too.
+		rest := content[colon+1:]
+		if skipYAMLProperties([]byte(rest), 0, len(rest)) == len(rest) {
+			pending, pendingIndent = keyPath, indent
+		}
+	}
+	return lines
+}
+
+// yamlKeyEnd returns the index of the colon ending the mapping key at the
+// start of s, or -1 if s doesn't start with a key.
+func yamlKeyEnd(s string) int {
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		return -1
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' && (i+1 == len(s) || s[i+1] == ' ' || s[i+1] == '\t') {
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a trailing comment from a line of YAML. It doesn't
+// know about quoting, so a " #" inside of a quoted string will be cut off,
+// too, which is fine for finding line numbers.
+func stripYAMLComment(line string) string {
+	if strings.HasPrefix(strings.TrimLeft(line, " "), "#") {
+		return ""
+	}
+	if i := strings.Index(line, " #"); i != -1 {
+		return line[:i]
+	}
+	return line
+}
+
+// quoteYAMLNumber returns a newVers function for pinEdits that quotes the new
+// versions of pins that are whole plain scalars in contents when the versions
+// would otherwise be decoded as numbers, like 1.30, which is the float 1.3.
+// Pins inside of quoted scalars or of longer ones, like the tag of
+// "golang:1.21", are left alone.
+func quoteYAMLNumber(contents []byte) func(p Pin, goVers string) string {
+	return func(p Pin, goVers string) string {
+		if p.Start == 0 || (contents[p.Start-1] != ' ' && contents[p.Start-1] != '\t') {
+			return goVers
+		}
+		if p.End < len(contents) && !isYAMLDelim(contents[p.End]) {
+			return goVers
+		}
+		if _, err := strconv.ParseFloat(goVers, 64); err == nil {
+			return `"` + goVers + `"`
+		}
+		return goVers
+	}
+}
+
+// yamlScalarLocator finds where the scalar values decoded from a YAML
+// document are in its source. The yaml package doesn't keep track of that, so
+// the values are found by searching the source for them. Values must be
+// looked for in the order they appear in the document so that repeated
+// values are found at each of their places in turn.
+type yamlScalarLocator struct {
+	src []byte
+	pos int
+}
+
+// find returns the offsets of the next plain or quoted scalar in the source
+// that match accepts, skipping comments.
+func (l *yamlScalarLocator) find(match func(tok string) bool) (int, int, bool) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' && (l.pos == 0 || isYAMLDelim(l.src[l.pos-1])) {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if isYAMLDelim(c) {
+			l.pos++
+			continue
+		}
+		start := l.pos
+		for l.pos < len(l.src) && !isYAMLDelim(l.src[l.pos]) {
+			l.pos++
+		}
+		if match(string(l.src[start:l.pos])) {
+			return start, l.pos, true
+		}
+	}
+	return 0, 0, false
+}
+
+// findString returns the offsets of the next scalar that's exactly s.
+func (l *yamlScalarLocator) findString(s string) (int, int, bool) {
+	return l.find(func(tok string) bool { return tok == s })
+}
+
+func isYAMLDelim(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '"', '\'', '[', ']', '{', '}', ',':
+		return true
+	}
+	return false
+}
+
+// walkMapSlicePaths calls fn on obj, if it's a yaml.MapSlice, and on every
+// yaml.MapSlice nested inside of it, along with their paths in the form that
+// yamlLineNumbers uses, like "stages[0].jobs[1]".
+func walkMapSlicePaths(obj interface{}, path string, fn func(path string, obj yaml.MapSlice)) {
+	switch o := obj.(type) {
+	case yaml.MapSlice:
+		fn(path, o)
+		for _, item := range o {
+			if k, ok := item.Key.(string); ok {
+				walkMapSlicePaths(item.Value, yamlPath(path, k), fn)
+			}
+		}
+	case []interface{}:
+		for i, x := range o {
+			walkMapSlicePaths(x, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
+
+// yamlPath returns the path of key in the mapping at path.
+func yamlPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// yamlScalarAt returns the offsets in src of the scalar value of the key or
+// sequence item at path, given the lines of src from yamlLineNumbers. The
+// offsets of quoted scalars leave out their quotes, and aliases are followed
+// to the scalar of their anchor. It returns false if the value isn't a scalar
+// on the same line as its key or item, or if path isn't written out in src,
+// like the paths inside of aliased collections.
+func yamlScalarAt(src []byte, lines map[string]int, path string) (int, int, bool) {
+	pos, end, ok := yamlValueAt(src, lines, path)
+	if !ok {
+		return 0, 0, false
+	}
+	return yamlScalarFrom(src, pos, end, 0)
+}
+
+// yamlInAlias reports whether path is inside of a collection that's an alias,
+// like the image of "- step: *build", whose values are only written out at
+// their anchor.
+func yamlInAlias(src []byte, lines map[string]int, path string) bool {
+	for p := path; p != ""; {
+		if pos, end, ok := yamlValueAt(src, lines, p); ok {
+			pos = skipYAMLProperties(src, pos, end)
+			return pos < end && src[pos] == '*'
+		}
+		i := strings.LastIndexAny(p, ".[")
+		if i == -1 {
+			break
+		}
+		p = p[:i]
+	}
+	return false
+}
+
+// yamlValueAt returns the offsets of the rest of the line after the key or
+// sequence item at path.
+func yamlValueAt(src []byte, lines map[string]int, path string) (int, int, bool) {
+	n, ok := lines[path]
+	if !ok {
+		return 0, 0, false
+	}
+	pos := 0
+	for ; n > 1; n-- {
+		pos += bytes.IndexByte(src[pos:], '\n') + 1
+	}
+	end := bytes.IndexByte(src[pos:], '\n')
+	if end == -1 {
+		end = len(src)
+	} else {
+		end += pos
+	}
+	pos = skipYAMLSpace(src, pos, end)
+	if strings.HasSuffix(path, "]") {
+		if pos == end || src[pos] != '-' {
+			return 0, 0, false
+		}
+		pos = skipYAMLSpace(src, pos+1, end)
+		if yamlKeyEnd(string(src[pos:end])) != -1 {
+			return 0, 0, false
+		}
+		return pos, end, true
+	}
+	// The first key of a mapping that's a sequence item comes after the
+	// item's dash.
+	for pos < end && src[pos] == '-' {
+		pos = skipYAMLSpace(src, pos+1, end)
+	}
+	colon := yamlKeyEnd(string(src[pos:end]))
+	if colon == -1 {
+		return 0, 0, false
+	}
+	return pos + colon + 1, end, true
+}
+
+// yamlScalarFrom returns the offsets of the scalar at the start of
+// src[pos:end], which is the rest of a line. depth is how many aliases have
+// been followed to get there.
+func yamlScalarFrom(src []byte, pos, end, depth int) (int, int, bool) {
+	pos = skipYAMLProperties(src, pos, end)
+	if pos == end {
+		return 0, 0, false
+	}
+	switch q := src[pos]; q {
+	case '*':
+		if depth > 0 {
+			return 0, 0, false
+		}
+		anchor := pos + 1
+		for pos < end && src[pos] != ' ' && src[pos] != '\t' && src[pos] != '\r' {
+			pos++
+		}
+		return yamlAnchoredScalar(src, "&"+string(src[anchor:pos]), depth+1)
+	case '"', '\'':
+		for i := pos + 1; i < end; i++ {
+			switch {
+			case q == '"' && src[i] == '\\':
+				i++
+			case q == '\'' && src[i] == '\'' && i+1 < end && src[i+1] == '\'':
+				i++
+			case src[i] == q:
+				return pos + 1, i, true
+			}
+		}
+		return 0, 0, false
+	case '#', '{', '[', '|', '>':
+		return 0, 0, false
+	}
+	if i := bytes.Index(src[pos:end], []byte(" #")); i != -1 {
+		end = pos + i
+	}
+	for end > pos && (src[end-1] == ' ' || src[end-1] == '\t' || src[end-1] == '\r') {
+		end--
+	}
+	return pos, end, true
+}
+
+// yamlAnchoredScalar returns the offsets of the scalar that has the anchor,
+// like "&go".
+func yamlAnchoredScalar(src []byte, anchor string, depth int) (int, int, bool) {
+	for pos := 0; ; {
+		i := bytes.Index(src[pos:], []byte(anchor))
+		if i == -1 {
+			return 0, 0, false
+		}
+		pos += i
+		after := pos + len(anchor)
+		if pos > 0 && (src[pos-1] == ' ' || src[pos-1] == '\t') &&
+			(after == len(src) || src[after] == ' ' || src[after] == '\t' || src[after] == '\r' || src[after] == '\n') {
+			end := bytes.IndexByte(src[pos:], '\n')
+			if end == -1 {
+				end = len(src)
+			} else {
+				end += pos
+			}
+			return yamlScalarFrom(src, pos, end, depth)
+		}
+		pos = after
+	}
+}
+
+// skipYAMLProperties skips the spaces, anchor, and tag before a value.
+func skipYAMLProperties(src []byte, pos, end int) int {
+	pos = skipYAMLSpace(src, pos, end)
+	for pos < end && (src[pos] == '&' || src[pos] == '!') {
+		for pos < end && src[pos] != ' ' && src[pos] != '\t' {
+			pos++
+		}
+		pos = skipYAMLSpace(src, pos, end)
+	}
+	return pos
+}
+
+func skipYAMLSpace(src []byte, pos, end int) int {
+	for pos < end && (src[pos] == ' ' || src[pos] == '\t') {
+		pos++
+	}
+	return pos
+}
@@ -0,0 +1,58 @@
+package ensure
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Release is a release of Go as described by the golang.org/dl API.
+type Release struct {
+	// Version is the release's name, like "go1.21.5".
+	Version string        `json:"version"`
+	Stable  bool          `json:"stable"`
+	Files   []ReleaseFile `json:"files"`
+}
+
+// ReleaseFile is one of the downloads (archive, installer, or source) that
+// make up a Go release.
+type ReleaseFile struct {
+	Filename string `json:"filename"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	SHA256   string `json:"sha256"`
+	Kind     string `json:"kind"`
+}
+
+// ReleasesURL is the golang.org/dl API's list of every release of Go.
+const ReleasesURL = "https://golang.org/dl/?mode=json&include=all"
+
+// GetReleases returns all of the stable releases of Go, newest first. Older
+// releases are included so that pins can be updated to the latest patch
+// release of their minor version.
+func GetReleases(c *HTTPClient) ([]Release, error) {
+	b, err := c.Get(ReleasesURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get list of Go releases from the golang.org/dl API: %s", err)
+	}
+	var releases []Release
+	err = json.Unmarshal(b, &releases)
+	if err != nil {
+		return nil, fmt.Errorf("unable to JSON parse golang.org/dl API response: %s", err)
+	}
+	var stable []Release
+	for _, rel := range releases {
+		if rel.Stable {
+			stable = append(stable, rel)
+		}
+	}
+	if len(stable) == 0 {
+		return nil, fmt.Errorf("no stable release found in golang.org/dl API response")
+	}
+	sort.SliceStable(stable, func(i, j int) bool {
+		vi, _ := parseGoVersion(stable[i].Version)
+		vj, _ := parseGoVersion(stable[j].Version)
+		return vi.compare(vj) > 0
+	})
+	return stable, nil
+}
@@ -0,0 +1,204 @@
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// The statuses of pins in a Report.
+const (
+	// StatusLatest is for pins on the latest release, or the latest release's
+	// minor version for pins without a patch version.
+	StatusLatest = "latest"
+	// StatusBehind is for pins on older releases.
+	StatusBehind = "behind"
+	// StatusUnpinned is for pins without a version, like "FROM golang".
+	StatusUnpinned = "unpinned"
+	// StatusUnknown is for versions that couldn't be parsed.
+	StatusUnknown = "unknown"
+)
+
+// Report is every Go version pinned in a repo and how far behind the latest
+// release each one is.
+type Report struct {
+	// Latest is the latest release of Go, like "1.22.3".
+	Latest string      `json:"latest"`
+	Pins   []PinReport `json:"pins"`
+}
+
+// PinReport is a pin in a Report.
+type PinReport struct {
+	// Type is the name of the type of file the pin is in, like "dockerfile".
+	Type string `json:"type"`
+	// Path is the slash-separated path of the file, relative to the repo's
+	// root.
+	Path string `json:"path"`
+	// Line and Column are where the version is in the file. Both start at 1,
+	// and Column counts characters, not bytes.
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Version string `json:"version"`
+	Status  string `json:"status"`
+	// Support is whether the pin's version is still supported, like
+	// SupportEOL. It's empty for versions that couldn't be parsed.
+	Support string `json:"support"`
+	// MinorsBehind is how many minor versions of Go have been released after
+	// the pin's, and PatchesBehind how many patch releases of the pin's minor
+	// version have been released after it.
+	MinorsBehind  int `json:"minors_behind"`
+	PatchesBehind int `json:"patches_behind"`
+	// DisagreesWith is where the newest minor version pinned in the repo is,
+	// like "go.mod:3", when this pin is on an older one.
+	DisagreesWith string `json:"disagrees_with,omitempty"`
+}
+
+// Location returns where the pin is, like "Dockerfile:1:14".
+func (p PinReport) Location() string {
+	return fmt.Sprintf("%s:%d:%d", p.Path, p.Line, p.Column)
+}
+
+// Behind describes how far behind the latest release the pin is, like "1
+// minor version and 2 patch releases behind".
+func (p PinReport) Behind() string {
+	switch p.Status {
+	case StatusLatest:
+		return "up to date"
+	case StatusUnpinned:
+		return "no version pinned"
+	case StatusUnknown:
+		return "unknown version"
+	}
+	var parts []string
+	if p.MinorsBehind > 0 {
+		parts = append(parts, plural(p.MinorsBehind, "minor version"))
+	}
+	if p.PatchesBehind > 0 {
+		parts = append(parts, plural(p.PatchesBehind, "patch release"))
+	}
+	if len(parts) == 0 {
+		return "behind"
+	}
+	if len(parts) == 2 {
+		return parts[0] + " and " + parts[1] + " behind"
+	}
+	return parts[0] + " behind"
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// ReadPins returns the pins that p finds in the files at the given absolute
+// paths, with their locations filled in but not their statuses. root is the
+// repo's root that the PinReports' paths are relative to.
+func ReadPins(p Pinner, root string, paths []string) ([]PinReport, error) {
+	var reports []PinReport
+	for _, fp := range paths {
+		contents, err := ioutil.ReadFile(fp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read contents of %s %#v: %s", p.Description(), fp, err)
+		}
+		pins, err := p.Pins(fp, contents)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, fp)
+		if err != nil {
+			rel = fp
+		}
+		for _, pin := range pins {
+			line, col := lineColumn(contents, pin.Start)
+			reports = append(reports, PinReport{
+				Type:    p.Name(),
+				Path:    filepath.ToSlash(rel),
+				Line:    line,
+				Column:  col,
+				Version: pin.Version,
+			})
+		}
+	}
+	return reports, nil
+}
+
+// lineColumn returns the 1-indexed line and character column of the byte
+// offset in contents.
+func lineColumn(contents []byte, offset int) (int, int) {
+	before := contents[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return line, utf8.RuneCount(before[lineStart:]) + 1
+}
+
+// NewReport fills in the statuses of the pins, and flags the ones that
+// disagree with the rest of the repo, using releases, which are newest first
+// like GetReleases returns them.
+func NewReport(pins []PinReport, releases []Release) Report {
+	r := Report{Pins: pins}
+	if r.Pins == nil {
+		r.Pins = []PinReport{}
+	}
+	if len(releases) == 0 {
+		return r
+	}
+	latest, ok := parseGoVersion(releases[0].Version)
+	if !ok {
+		return r
+	}
+	r.Latest = latest.String()
+
+	newest, newestAt := goVersion{}, -1
+	for i := range r.Pins {
+		p := &r.Pins[i]
+		p.Support = Support(p.Version, releases)
+		if p.Version == "" {
+			p.Status = StatusUnpinned
+			continue
+		}
+		v, ok := parseGoVersion(p.Version)
+		if !ok {
+			p.Status = StatusUnknown
+			continue
+		}
+		if v.major == latest.major && v.minor < latest.minor {
+			p.MinorsBehind = latest.minor - v.minor
+		}
+		if v.parts == 3 {
+			for _, rel := range releases {
+				relVers, ok := parseGoVersion(rel.Version)
+				if ok && relVers.sameMinor(v) {
+					if relVers.patch > v.patch {
+						p.PatchesBehind = relVers.patch - v.patch
+					}
+					break
+				}
+			}
+		}
+		p.Status = StatusLatest
+		if p.MinorsBehind > 0 || p.PatchesBehind > 0 {
+			p.Status = StatusBehind
+		}
+		if newestAt == -1 || v.minorString() != newest.minorString() && v.compare(newest) > 0 {
+			newest, newestAt = v, i
+		}
+	}
+	if newestAt == -1 {
+		return r
+	}
+	at := fmt.Sprintf("%s:%d", r.Pins[newestAt].Path, r.Pins[newestAt].Line)
+	for i := range r.Pins {
+		p := &r.Pins[i]
+		if p.Status != StatusLatest && p.Status != StatusBehind {
+			continue
+		}
+		if v, _ := parseGoVersion(p.Version); !v.sameMinor(newest) {
+			p.DisagreesWith = at
+		}
+	}
+	return r
+}
@@ -0,0 +1,235 @@
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// starlark.go is a tokenizer for the Starlark files Bazel reads, like
+// MODULE.bazel and WORKSPACE. It's only as smart as it needs to be to find
+// function calls and their keyword arguments. Indentation isn't tracked
+// because the calls we care about are expressions.
+
+type starlarkTokenKind int
+
+const (
+	starlarkIdent starlarkTokenKind = iota
+	starlarkString
+	starlarkNumber
+	starlarkPunct
+)
+
+type starlarkToken struct {
+	kind starlarkTokenKind
+	// start and end are the byte offsets of the token in the source. For
+	// strings, they include any prefix and the quotes.
+	start, end int
+	// text is the source text of identifiers, numbers, and punctuation, and
+	// the value of strings.
+	text string
+	// quote is the quote used by a string, like `"` or `'''`.
+	quote string
+}
+
+func (t starlarkToken) is(kind starlarkTokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+// starlarkPuncts are the multi-character operators, longest first, so that
+// "==" and "**=" aren't mistaken for "=".
+var starlarkPuncts = []string{"**=", "//=", ">>=", "<<=", "==", "!=", "<=", ">=", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "**", "//", "<<", ">>", "->"}
+
+func tokenizeStarlark(src []byte) ([]starlarkToken, error) {
+	var toks []starlarkToken
+	pos := 0
+	for pos < len(src) {
+		c := src[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pos++
+		case c == '\\' && pos+1 < len(src) && (src[pos+1] == '\n' || src[pos+1] == '\r'):
+			pos += 2
+		case c == '#':
+			end := bytes.IndexByte(src[pos:], '\n')
+			if end == -1 {
+				pos = len(src)
+			} else {
+				pos += end
+			}
+		case isStarlarkStringStart(src[pos:]):
+			tok, err := lexStarlarkString(src, pos)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, tok)
+			pos = tok.end
+		case isIdentStart(c):
+			start := pos
+			for pos < len(src) && (isIdentStart(src[pos]) || isDigit(src[pos])) {
+				pos++
+			}
+			toks = append(toks, starlarkToken{kind: starlarkIdent, start: start, end: pos, text: string(src[start:pos])})
+		case isDigit(c):
+			start := pos
+			for pos < len(src) && (isIdentStart(src[pos]) || isDigit(src[pos]) || src[pos] == '.') {
+				pos++
+			}
+			toks = append(toks, starlarkToken{kind: starlarkNumber, start: start, end: pos, text: string(src[start:pos])})
+		default:
+			text := string(c)
+			for _, p := range starlarkPuncts {
+				if bytes.HasPrefix(src[pos:], []byte(p)) {
+					text = p
+					break
+				}
+			}
+			toks = append(toks, starlarkToken{kind: starlarkPunct, start: pos, end: pos + len(text), text: text})
+			pos += len(text)
+		}
+	}
+	return toks, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isStarlarkStringStart reports whether b starts with a string literal,
+// including ones with r, b, or rb prefixes.
+func isStarlarkStringStart(b []byte) bool {
+	for i := 0; i < len(b) && i < 3; i++ {
+		switch b[i] {
+		case '"', '\'':
+			return true
+		case 'r', 'R', 'b', 'B':
+			continue
+		}
+		return false
+	}
+	return false
+}
+
+func lexStarlarkString(src []byte, start int) (starlarkToken, error) {
+	pos := start
+	raw := false
+	for src[pos] != '"' && src[pos] != '\'' {
+		if src[pos] == 'r' || src[pos] == 'R' {
+			raw = true
+		}
+		pos++
+	}
+	quote := string(src[pos])
+	if bytes.HasPrefix(src[pos:], []byte(strings.Repeat(quote, 3))) {
+		quote = strings.Repeat(quote, 3)
+	}
+	pos += len(quote)
+	var val strings.Builder
+	for {
+		if pos >= len(src) || (len(quote) == 1 && src[pos] == '\n') {
+			line := bytes.Count(src[:start], []byte{'\n'}) + 1
+			return starlarkToken{}, fmt.Errorf("line %d: unterminated string", line)
+		}
+		if bytes.HasPrefix(src[pos:], []byte(quote)) {
+			pos += len(quote)
+			break
+		}
+		c := src[pos]
+		if c == '\\' && pos+1 < len(src) {
+			if raw {
+				val.WriteByte(c)
+			}
+			pos++
+			c = src[pos]
+			if !raw {
+				switch c {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				}
+			}
+		}
+		val.WriteByte(c)
+		pos++
+	}
+	return starlarkToken{kind: starlarkString, start: start, end: pos, text: val.String(), quote: quote}, nil
+}
+
+// starlarkCall is a call to a function found in a Starlark file.
+type starlarkCall struct {
+	// name is the dotted name of the function called, like "go_sdk.download".
+	name string
+	// kwargs are the keyword arguments of the call. The tokens of each
+	// argument's value are included, but the separating commas aren't.
+	kwargs map[string][]starlarkToken
+}
+
+// findStarlarkCalls returns every call of a named function in toks, including
+// ones nested inside of other calls.
+func findStarlarkCalls(toks []starlarkToken) []starlarkCall {
+	var calls []starlarkCall
+	for i := 0; i < len(toks); i++ {
+		if toks[i].kind != starlarkIdent {
+			continue
+		}
+		// Don't start a name in the middle of a dotted name.
+		if i > 0 && toks[i-1].is(starlarkPunct, ".") {
+			continue
+		}
+		name := toks[i].text
+		j := i + 1
+		for j+1 < len(toks) && toks[j].is(starlarkPunct, ".") && toks[j+1].kind == starlarkIdent {
+			name += "." + toks[j+1].text
+			j += 2
+		}
+		if j >= len(toks) || !toks[j].is(starlarkPunct, "(") {
+			continue
+		}
+		calls = append(calls, starlarkCall{name: name, kwargs: starlarkKwargs(toks[j+1:])})
+	}
+	return calls
+}
+
+// starlarkKwargs returns the keyword arguments of the call whose arguments
+// start at toks.
+func starlarkKwargs(toks []starlarkToken) map[string][]starlarkToken {
+	kwargs := make(map[string][]starlarkToken)
+	depth := 0
+	argStart := 0
+	for i, tok := range toks {
+		if tok.kind != starlarkPunct {
+			continue
+		}
+		switch tok.text {
+		case "(", "[", "{":
+			depth++
+			continue
+		case ")", "]", "}":
+			if depth > 0 {
+				depth--
+				continue
+			}
+		case ",":
+			if depth > 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		// We're at the end of an argument.
+		arg := toks[argStart:i]
+		if len(arg) >= 2 && arg[0].kind == starlarkIdent && arg[1].is(starlarkPunct, "=") {
+			kwargs[arg[0].text] = arg[2:]
+		}
+		if tok.text != "," {
+			break
+		}
+		argStart = i + 1
+	}
+	return kwargs
+}
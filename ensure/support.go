@@ -0,0 +1,137 @@
+package ensure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// The support statuses of pinned Go versions. The Go project supports each
+// minor version of Go until two newer ones have been released, so only the
+// two newest minor versions get security fixes.
+const (
+	// SupportCurrent is for pins on the latest release, or something newer
+	// like a release candidate, and for pins of just the latest minor
+	// version.
+	SupportCurrent = "current"
+	// SupportBehind is for pins on a supported minor version that aren't on
+	// the latest release.
+	SupportBehind = "supported-but-behind"
+	// SupportEOL is for pins on a minor version that's no longer supported.
+	SupportEOL = "end-of-life"
+)
+
+// Support classifies the pinned Go version, like "1.21.5" or "1.21", using
+// releases, which are newest first like GetReleases returns them. Pins without
+// a version are current because they get whatever the latest release is. It's
+// empty for versions that can't be parsed.
+func Support(pinned string, releases []Release) string {
+	if pinned == "" {
+		return SupportCurrent
+	}
+	v, ok := parseGoVersion(pinned)
+	if !ok || len(releases) == 0 {
+		return ""
+	}
+	latest, ok := parseGoVersion(releases[0].Version)
+	if !ok {
+		return ""
+	}
+	switch {
+	case v.compare(latest) >= 0:
+		return SupportCurrent
+	case v.parts == 2 && v.pre == "" && v.sameMinor(latest):
+		// Pins of just a minor version get its latest patch release.
+		return SupportCurrent
+	case v.major == latest.major && v.minor >= latest.minor-1:
+		return SupportBehind
+	}
+	return SupportEOL
+}
+
+// SupportedMinors returns the minor versions of Go, like "1.22" and "1.21",
+// that are still supported according to releases, which are newest first.
+func SupportedMinors(releases []Release) []string {
+	if len(releases) == 0 {
+		return nil
+	}
+	latest, ok := parseGoVersion(releases[0].Version)
+	if !ok {
+		return nil
+	}
+	minors := []string{latest.minorString()}
+	if latest.minor > 0 {
+		prev := goVersion{major: latest.major, minor: latest.minor - 1, parts: 2}
+		minors = append(minors, prev.minorString())
+	}
+	return minors
+}
+
+// UnsupportedPin is a pin on an end-of-life version of Go that updating
+// leaves on one.
+type UnsupportedPin struct {
+	PinReport
+	// Kept is whether the pin is an older entry in a list of versions, like a
+	// Travis CI matrix, that updating adds the new version to instead of
+	// replacing the old ones. Otherwise, it's held back by its file's
+	// policy, like PolicyPatch.
+	Kept bool `json:"kept"`
+	// NewVersion is the version that updating leaves the pin on, which is
+	// its current Version unless its policy updates it within its minor
+	// version.
+	NewVersion string `json:"new_version"`
+}
+
+// UnsupportedPins returns the pins in the files at the given absolute paths
+// that are on end-of-life versions of Go and still will be after updating
+// them with u. Files whose config rule has the skip policy aren't read at
+// all.
+func UnsupportedPins(u Updater, paths []string, ts Targets) ([]UnsupportedPin, error) {
+	var unsupported []UnsupportedPin
+	for _, fp := range paths {
+		t := ts.ForFile(u.Name(), fp)
+		if t.Policy == PolicySkip {
+			continue
+		}
+		contents, err := ioutil.ReadFile(fp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read contents of %s %#v: %s", u.Description(), fp, err)
+		}
+		pins, err := u.Pins(fp, contents)
+		if err != nil {
+			return nil, err
+		}
+		kept, err := keptPins(u, fp, contents)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(ts.Root, fp)
+		if err != nil {
+			rel = fp
+		}
+		for _, p := range pins {
+			isKept := len(withoutPins([]Pin{p}, kept)) == 0
+			newVers := p.Version
+			if goVers, ok := resolvePin(u, contents, p, t); ok && !isKept {
+				newVers = goVers
+			}
+			if Support(newVers, t.Releases) != SupportEOL {
+				continue
+			}
+			line, col := lineColumn(contents, p.Start)
+			unsupported = append(unsupported, UnsupportedPin{
+				PinReport: PinReport{
+					Type:    u.Name(),
+					Path:    filepath.ToSlash(rel),
+					Line:    line,
+					Column:  col,
+					Version: p.Version,
+					Support: SupportEOL,
+				},
+				Kept:       isKept,
+				NewVersion: newVers,
+			})
+		}
+	}
+	return unsupported, nil
+}
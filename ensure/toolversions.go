@@ -0,0 +1,162 @@
+package ensure
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The tool version files are the plain files read by tools that install Go
+// for developers and CI systems. Each holds a Go version alongside, in some
+// cases, the versions of other tools, which are left alone.
+
+// GHActionVersionFile is the file that the GitHub Action's README suggests
+// keeping the Go version used by actions/setup-go in.
+const GHActionVersionFile = ".github/versions/go"
+
+// toolGoVersionRe matches the Go versions that the tool version files are
+// allowed to be updated from. Special values like "latest", "system", or
+// "ref:master" are not matched and are left alone.
+var toolGoVersionRe = regexp.MustCompile(`^\d+\.\d+(\.\d+)?([a-z]+\d*)?$`)
+
+// GoVersionFileUpdater updates files that contain only a Go version, like
+// .github/versions/go or goenv's .go-version. Any whitespace around the
+// version is kept.
+type GoVersionFileUpdater struct{}
+
+func (GoVersionFileUpdater) Name() string        { return "goversion" }
+func (GoVersionFileUpdater) Description() string { return "Go version file" }
+
+func (GoVersionFileUpdater) Patterns() []string {
+	return []string{GHActionVersionFile, ".go-version"}
+}
+
+func (GoVersionFileUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	goVers := bytes.TrimSpace(contents)
+	if len(goVers) == 0 {
+		return nil, nil
+	}
+	if !toolGoVersionRe.Match(goVers) {
+		return nil, fmt.Errorf("unable to parse Go version file %#v: %#v is not a Go version", fp, string(goVers))
+	}
+	start := bytes.Index(contents, goVers)
+	return []Pin{{string(goVers), start, start + len(goVers)}}, nil
+}
+
+func (u GoVersionFileUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, nil), nil
+}
+
+// toolVersionsGoLineRe matches the line of an asdf .tool-versions file that
+// sets the version of Go. asdf's Go plugin is named "golang", but mise also
+// reads .tool-versions files and calls it "go". Only the first version listed
+// is updated because it's the one used by default.
+var toolVersionsGoLineRe = regexp.MustCompile(`(?m)^[ \t]*(?:golang|go)[ \t]+(\S+)`)
+
+// ToolVersionsUpdater updates the Go version in an asdf .tool-versions file
+// while keeping the lines for its other tools.
+type ToolVersionsUpdater struct{}
+
+func (ToolVersionsUpdater) Name() string        { return "toolversions" }
+func (ToolVersionsUpdater) Description() string { return "asdf .tool-versions file" }
+func (ToolVersionsUpdater) Patterns() []string  { return []string{".tool-versions"} }
+
+func (ToolVersionsUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	var pins []Pin
+	for _, m := range toolVersionsGoLineRe.FindAllSubmatchIndex(contents, -1) {
+		start, end := m[2], m[3]
+		if toolGoVersionRe.Match(contents[start:end]) {
+			pins = append(pins, Pin{string(contents[start:end]), start, end})
+		}
+	}
+	return pins, nil
+}
+
+func (u ToolVersionsUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, nil), nil
+}
+
+var (
+	tomlTableRe = regexp.MustCompile(`^\s*\[\[?([^\[\]]*)\]\]?\s*(#.*)?$`)
+	// miseToolsGoKeyRe and miseDottedGoKeyRe match the Go entry of mise's
+	// tools table, whether it's written inside of a [tools] table or as a
+	// dotted key at the top level.
+	miseToolsGoKeyRe  = regexp.MustCompile(`^\s*(?:go|"go"|'go')\s*=`)
+	miseDottedGoKeyRe = regexp.MustCompile(`^\s*tools\s*\.\s*(?:go|"go"|'go')\s*=`)
+	// miseVersionKeyRe matches the version key of a [tools.go] table.
+	miseVersionKeyRe = regexp.MustCompile(`^\s*(?:version|"version"|'version')\s*=`)
+	// tomlStringRe matches the first basic or literal TOML string in a value.
+	// It's the version in all of `"1.21"`, `["1.21", "1.20"]` and
+	// `{ version = "1.21" }`.
+	tomlStringRe = regexp.MustCompile(`"([^"\\]*)"|'([^']*)'`)
+)
+
+// MiseUpdater updates the Go version in a mise.toml file, whether it's the go
+// key of the [tools] table, a top-level tools.go dotted key, or the version
+// key of a [tools.go] table. The file is edited line by line instead of being
+// parsed and re-encoded so that its formatting and comments are kept exactly.
+type MiseUpdater struct{}
+
+func (MiseUpdater) Name() string        { return "mise" }
+func (MiseUpdater) Description() string { return "mise config file" }
+func (MiseUpdater) Patterns() []string  { return []string{"mise.toml", ".mise.toml"} }
+
+func (MiseUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	var pins []Pin
+	var table string
+	lineStart := 0
+	for i, line := range bytes.Split(contents, []byte{'\n'}) {
+		offset := lineStart
+		lineStart += len(line) + 1
+		if m := tomlTableRe.FindSubmatch(line); m != nil {
+			// Table names like [ tools . "go" ] are the same as
+			// [tools.go].
+			table = strings.NewReplacer(" ", "", "\t", "", `"`, "", "'", "").Replace(string(m[1]))
+			continue
+		}
+		var key []int
+		switch table {
+		case "tools":
+			key = miseToolsGoKeyRe.FindIndex(line)
+		case "tools.go":
+			key = miseVersionKeyRe.FindIndex(line)
+		case "":
+			key = miseDottedGoKeyRe.FindIndex(line)
+		}
+		if key == nil {
+			continue
+		}
+		val := tomlStringRe.FindSubmatchIndex(line[key[1]:])
+		if val == nil {
+			return nil, fmt.Errorf("unable to parse mise config file %#v: line %d has no Go version string", fp, i+1)
+		}
+		// Either the basic or the literal string group matched.
+		start, end := val[2], val[3]
+		if start == -1 {
+			start, end = val[4], val[5]
+		}
+		start, end = start+key[1], end+key[1]
+		if !toolGoVersionRe.Match(line[start:end]) {
+			continue
+		}
+		pins = append(pins, Pin{string(line[start:end]), offset + start, offset + end})
+	}
+	return pins, nil
+}
+
+func (u MiseUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	pins, err := u.Pins(fp, contents)
+	if err != nil {
+		return nil, err
+	}
+	return pinEdits(pins, t, nil), nil
+}
@@ -0,0 +1,162 @@
+package ensure
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/jmhodges/yaml.v2"
+)
+
+// TravisUpdater updates the "go" setting of a Travis CI config. A single
+// version is replaced, and a list of versions has the new version added to it
+// so that the older ones keep being tested against.
+type TravisUpdater struct{}
+
+func (TravisUpdater) Name() string        { return "travis" }
+func (TravisUpdater) Description() string { return "Travis CI config file" }
+func (TravisUpdater) Patterns() []string  { return []string{".travis.yml"} }
+
+var travisGoKeyRe = regexp.MustCompile(`(?m)^(?:go|"go"|'go')[ \t]*:`)
+
+func (TravisUpdater) Pins(fp string, contents []byte) ([]Pin, error) {
+	ty, i, err := parseTravisFile(fp, contents)
+	if err != nil || i == -1 {
+		return nil, err
+	}
+	var versions []string
+	switch goVersions := ty[i].Value.(type) {
+	case string:
+		versions = []string{goVersions}
+	case []interface{}:
+		for _, v := range goVersions {
+			versions = append(versions, v.(string))
+		}
+	}
+	// The versions are after the top-level "go" key.
+	key := travisGoKeyRe.FindIndex(contents)
+	if key == nil {
+		return nil, fmt.Errorf("unable to find the 'go' setting in Travis CI config file %#v", fp)
+	}
+	loc := &yamlScalarLocator{src: contents, pos: key[1]}
+	var pins []Pin
+	for _, v := range versions {
+		start, end, ok := loc.findString(v)
+		if !ok {
+			return nil, fmt.Errorf("unable to find Go version %#v in Travis CI config file %#v", v, fp)
+		}
+		pins = append(pins, Pin{v, start, end})
+	}
+	return pins, nil
+}
+
+// KeptPins returns the entries of a list of versions that updating leaves in
+// place, which are all but the newest one when there's more than one
+// version.
+func (tu TravisUpdater) KeptPins(fp string, contents []byte) ([]Pin, error) {
+	pins, err := tu.Pins(fp, contents)
+	if err != nil || len(pins) < 2 {
+		return nil, err
+	}
+	var newest goVersion
+	found := false
+	for _, p := range pins {
+		v, ok := parseGoVersion(p.Version)
+		if ok && (!found || v.compare(newest) > 0) {
+			newest, found = v, true
+		}
+	}
+	var kept []Pin
+	for _, p := range pins {
+		if v, ok := parseGoVersion(p.Version); !ok || !found || v.compare(newest) != 0 {
+			kept = append(kept, p)
+		}
+	}
+	if len(kept) == 0 {
+		// Every entry is the same version, which gets replaced.
+		return nil, nil
+	}
+	return kept, nil
+}
+
+func (TravisUpdater) Edits(fp string, contents []byte, t Target) ([]Edit, error) {
+	ty, i, err := parseTravisFile(fp, contents)
+	if err != nil || i == -1 {
+		return nil, err
+	}
+	var fileContentsUpdated bool
+	switch oldGoVers := ty[i].Value.(type) {
+	case string:
+		goVers, ok := t.Resolve(oldGoVers)
+		if ok && oldGoVers != goVers {
+			ty[i].Value = goVers
+			fileContentsUpdated = true
+		}
+	case []interface{}:
+		versions := make(map[string]bool)
+		var out []string
+		// The new version is picked based on the newest one already being
+		// tested against.
+		var newest string
+		var newestVers goVersion
+
+		for _, oldVersInt := range oldGoVers {
+			oldVers := oldVersInt.(string)
+			if !versions[oldVers] {
+				out = append(out, oldVers)
+				versions[oldVers] = true
+			}
+			v, ok := parseGoVersion(oldVers)
+			if ok && (newest == "" || v.compare(newestVers) > 0) {
+				newest, newestVers = oldVers, v
+			}
+		}
+		goVers, ok := t.Resolve(newest)
+		if ok && !versions[goVers] {
+			fileContentsUpdated = true
+			if len(versions) == 1 {
+				ty[i].Value = []string{goVers}
+			} else {
+				ty[i].Value = append(out, goVers)
+			}
+		}
+	}
+	if !fileContentsUpdated {
+		return nil, nil
+	}
+	newContents, err := yamlMarshal(ty)
+	if err != nil {
+		return nil, err
+	}
+	return wholeFileEdit(contents, newContents), nil
+}
+
+// parseTravisFile parses a Travis CI config and returns the index of its "go"
+// setting, or -1 if it doesn't have one. The setting is checked to be a
+// string or a list of strings.
+func parseTravisFile(fp string, contents []byte) (yaml.MapSlice, int, error) {
+	var ty yaml.MapSlice
+	err := yaml.Unmarshal(contents, &ty)
+	if err != nil {
+		return nil, -1, fmt.Errorf("unable to parse YAML Travis CI config file %#v: %s", fp, err)
+	}
+
+	i, goVersions, err := findMapItem(ty, "go")
+	if err != nil {
+		return nil, -1, fmt.Errorf("unable to parse YAML Travis CI config file %#v: %s", fp, err)
+	}
+	if i == -1 {
+		return ty, -1, nil
+	}
+	switch vers := goVersions.(type) {
+	case string:
+	case []interface{}:
+		for _, v := range vers {
+			if _, ok := v.(string); !ok {
+				return nil, -1, fmt.Errorf("unknown type in 'go' array in travis config file %#v: %T", fp, v)
+			}
+		}
+	default:
+		return nil, -1, fmt.Errorf("unknown type for 'go' value in travis config file %#v: %T", fp, vers)
+	}
+	return ty, i, nil
+}
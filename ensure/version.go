@@ -0,0 +1,206 @@
+package ensure
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// goVersion is a parsed Go version like "1.21.5", "1.20", or "1.22rc1".
+type goVersion struct {
+	major, minor, patch int
+	// parts is the number of dotted parts the version was written with. It's
+	// 2 for "1.20" and 3 for "1.20.1".
+	parts int
+	// pre is the prerelease suffix, like "rc1" or "beta2", if any.
+	pre string
+}
+
+var goVersionRe = regexp.MustCompile(`^(?:go)?(\d+)\.(\d+)(?:\.(\d+))?((?:rc|beta)\d+)?$`)
+
+// parseGoVersion parses a Go version with or without the "go" prefix used in
+// release names.
+func parseGoVersion(s string) (goVersion, bool) {
+	m := goVersionRe.FindStringSubmatch(s)
+	if m == nil {
+		return goVersion{}, false
+	}
+	v := goVersion{parts: 2, pre: m[4]}
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.patch, _ = strconv.Atoi(m[3])
+		v.parts = 3
+	}
+	return v, true
+}
+
+func (v goVersion) String() string {
+	if v.parts == 2 {
+		return fmt.Sprintf("%d.%d%s", v.major, v.minor, v.pre)
+	}
+	return fmt.Sprintf("%d.%d.%d%s", v.major, v.minor, v.patch, v.pre)
+}
+
+// minorString returns just the major and minor parts of v, like "1.21".
+func (v goVersion) minorString() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+func (v goVersion) sameMinor(o goVersion) bool {
+	return v.major == o.major && v.minor == o.minor
+}
+
+// compare returns -1, 0, or 1 if v is older than, the same as, or newer than
+// o. A missing patch version is treated as 0, and prereleases are older than
+// the release they precede.
+func (v goVersion) compare(o goVersion) int {
+	switch {
+	case v.major != o.major:
+		return cmpInt(v.major, o.major)
+	case v.minor != o.minor:
+		return cmpInt(v.minor, o.minor)
+	case v.patch != o.patch:
+		return cmpInt(v.patch, o.patch)
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	// "beta" sorts before "rc", and the numbers after them are compared as
+	// numbers.
+	vKind, vNum := splitPrerelease(v.pre)
+	oKind, oNum := splitPrerelease(o.pre)
+	if vKind != oKind {
+		if vKind < oKind {
+			return -1
+		}
+		return 1
+	}
+	return cmpInt(vNum, oNum)
+}
+
+func splitPrerelease(pre string) (string, int) {
+	i := len(pre)
+	for i > 0 && isDigit(pre[i-1]) {
+		i--
+	}
+	n, _ := strconv.Atoi(pre[i:])
+	return pre[:i], n
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// The version policies say which release a pinned Go version should be
+// updated to.
+const (
+	// PolicyLatest updates pins to the latest stable release of Go.
+	PolicyLatest = "latest"
+	// PolicyPatch updates pins to the latest patch release of the minor
+	// version they're already on.
+	PolicyPatch = "patch"
+	// PolicySkip leaves pins alone.
+	PolicySkip = "skip"
+	// PolicySecurity updates pins to the latest stable release of Go only if
+	// they're affected by a vulnerability in the standard library or
+	// toolchain that a newer release fixes.
+	PolicySecurity = "security"
+)
+
+// The precisions say how many parts of the new version are written.
+const (
+	// PrecisionFull writes the full release version, like "1.21.5".
+	PrecisionFull = "full"
+	// PrecisionMinor writes only the major and minor parts, like "1.21".
+	PrecisionMinor = "minor"
+	// PrecisionPreserve writes as many parts as the pin already had.
+	PrecisionPreserve = "preserve"
+)
+
+// Target decides what each Go version pinned in a file should be updated to.
+type Target struct {
+	// Releases are the stable releases of Go, newest first.
+	Releases []Release
+	// Policy is one of the policy constants.
+	Policy string
+	// Precision is one of the precision constants.
+	Precision string
+	// AllowDowngrade lets pins newer than the version picked by the policy
+	// be changed to it.
+	AllowDowngrade bool
+	// Vulns are the known vulnerabilities in Go, if they've been loaded. The
+	// security policy never updates anything without them.
+	Vulns *VulnDB
+}
+
+// Resolve returns the version that the pinned version oldVers should be
+// written as, and false if the pin should be left alone. oldVers is empty for
+// pins that don't name a version, like a "FROM golang" line in a Dockerfile.
+func (t Target) Resolve(oldVers string) (string, bool) {
+	_, newVers, ok := t.ResolveRelease(oldVers)
+	return newVers, ok
+}
+
+// ResolveRelease is Resolve but also returns the release that the new version
+// is from.
+func (t Target) ResolveRelease(oldVers string) (Release, string, bool) {
+	if t.Policy == PolicySkip || len(t.Releases) == 0 {
+		return Release{}, "", false
+	}
+	old, oldOK := parseGoVersion(oldVers)
+	var rel Release
+	var relVers goVersion
+	switch t.Policy {
+	case PolicyPatch:
+		if !oldOK {
+			return Release{}, "", false
+		}
+		found := false
+		for _, r := range t.Releases {
+			v, ok := parseGoVersion(r.Version)
+			if ok && v.sameMinor(old) {
+				rel, relVers, found = r, v, true
+				break
+			}
+		}
+		if !found {
+			return Release{}, "", false
+		}
+	default:
+		rel = t.Releases[0]
+		var ok bool
+		relVers, ok = parseGoVersion(rel.Version)
+		if !ok {
+			return Release{}, "", false
+		}
+	}
+	if oldOK && !t.AllowDowngrade && relVers.compare(old) < 0 {
+		return Release{}, "", false
+	}
+	// Vulnerabilities that aren't fixed yet, or that the new release is
+	// still affected by, aren't a reason to update.
+	if t.Policy == PolicySecurity && len(t.Vulns.Fixed([]string{oldVers}, relVers.String(), t.Releases)) == 0 {
+		return Release{}, "", false
+	}
+
+	newVers := relVers.String()
+	switch t.Precision {
+	case PrecisionMinor:
+		newVers = relVers.minorString()
+	case PrecisionPreserve:
+		if oldOK && old.parts == 2 {
+			newVers = relVers.minorString()
+		}
+	}
+	return rel, newVers, true
+}
@@ -0,0 +1,289 @@
+package ensure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultVulnDB is the Go vulnerability database.
+const DefaultVulnDB = "https://vuln.go.dev"
+
+// vulnModules are the modules that vulnerabilities in Go itself are reported
+// against in the Go vulnerability database.
+var vulnModules = []string{"stdlib", "toolchain"}
+
+// Vuln is the part of an OSV entry in the Go vulnerability database that we
+// use.
+type Vuln struct {
+	// ID is the database's ID of the vulnerability, like "GO-2024-2887".
+	ID      string   `json:"id"`
+	Summary string   `json:"summary"`
+	Aliases []string `json:"aliases"`
+	// Affected are the modules the vulnerability is in and the versions of
+	// them it affects.
+	Affected []struct {
+		Package struct {
+			Name string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced string `json:"introduced"`
+				Fixed      string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		URL string `json:"url"`
+	} `json:"database_specific"`
+}
+
+// URL returns the vulnerability's page.
+func (v *Vuln) URL() string {
+	if v.DatabaseSpecific.URL != "" {
+		return v.DatabaseSpecific.URL
+	}
+	return "https://pkg.go.dev/vuln/" + v.ID
+}
+
+// Affects reports whether the Go release goVers, like "1.21.5", is affected
+// by the vulnerability, and the version of Go it's fixed in, if there is one.
+func (v *Vuln) Affects(goVers string) (bool, string) {
+	semver, ok := vulnSemver(goVers)
+	if !ok {
+		return false, ""
+	}
+	for _, a := range v.Affected {
+		if !contains(vulnModules, a.Package.Name) {
+			continue
+		}
+		for _, r := range a.Ranges {
+			if r.Type != "SEMVER" {
+				continue
+			}
+			// The events are in order, and each "introduced" is followed by
+			// the "fixed" that ends it, if it's been fixed.
+			affected := false
+			for _, e := range r.Events {
+				switch {
+				case e.Introduced != "":
+					affected = e.Introduced == "0" || compareSemver(semver, e.Introduced) >= 0
+				case e.Fixed != "" && affected:
+					if compareSemver(semver, e.Fixed) < 0 {
+						return true, e.Fixed
+					}
+					affected = false
+				}
+			}
+			if affected {
+				return true, ""
+			}
+		}
+	}
+	return false, ""
+}
+
+// VulnDB is the vulnerabilities in the Go standard library and toolchain from
+// an OSV database laid out like the Go vulnerability database.
+type VulnDB struct {
+	Vulns []*Vuln
+}
+
+// LoadVulnDB reads the vulnerabilities in Go itself from the database at
+// source, which is either a URL, like DefaultVulnDB, that's fetched with c, or
+// a local directory with the same layout.
+func LoadVulnDB(c *HTTPClient, source string) (*VulnDB, error) {
+	read := func(path string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(source, filepath.FromSlash(path)))
+	}
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		read = func(path string) ([]byte, error) {
+			return c.Get(strings.TrimSuffix(source, "/") + "/" + path)
+		}
+	}
+	b, err := read("index/modules.json")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read vulnerability database %#v: %s", source, err)
+	}
+	var modules []struct {
+		Path  string `json:"path"`
+		Vulns []struct {
+			ID string `json:"id"`
+		} `json:"vulns"`
+	}
+	if err := json.Unmarshal(b, &modules); err != nil {
+		return nil, fmt.Errorf("unable to JSON parse the index of vulnerability database %#v: %s", source, err)
+	}
+	db := &VulnDB{}
+	seen := make(map[string]bool)
+	for _, m := range modules {
+		if !contains(vulnModules, m.Path) {
+			continue
+		}
+		for _, mv := range m.Vulns {
+			if seen[mv.ID] {
+				continue
+			}
+			seen[mv.ID] = true
+			b, err := read("ID/" + mv.ID + ".json")
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s from vulnerability database %#v: %s", mv.ID, source, err)
+			}
+			v := &Vuln{}
+			if err := json.Unmarshal(b, v); err != nil {
+				return nil, fmt.Errorf("unable to JSON parse %s from vulnerability database %#v: %s", mv.ID, source, err)
+			}
+			db.Vulns = append(db.Vulns, v)
+		}
+	}
+	return db, nil
+}
+
+// Affecting returns the vulnerabilities that affect the pinned Go version,
+// like "1.21.5". Pins of just a minor version, like "1.21", are taken to be
+// the latest of releases, which are newest first, in that minor version since
+// that's what tools that accept them install.
+func (db *VulnDB) Affecting(pinned string, releases []Release) []*Vuln {
+	if db == nil {
+		return nil
+	}
+	goVers := floatingVersion(pinned, releases)
+	var vulns []*Vuln
+	for _, v := range db.Vulns {
+		if affected, _ := v.Affects(goVers); affected {
+			vulns = append(vulns, v)
+		}
+	}
+	return vulns
+}
+
+// FixedVuln is a vulnerability that an update fixes.
+type FixedVuln struct {
+	*Vuln
+	// Fixed is the earliest release, like "1.21.11", that fixes it for the
+	// oldest of the versions being updated from.
+	Fixed string
+}
+
+// Fixed returns the vulnerabilities that affect any of oldVersions but not
+// goVers.
+func (db *VulnDB) Fixed(oldVersions []string, goVers string, releases []Release) []FixedVuln {
+	if db == nil {
+		return nil
+	}
+	var fixed []FixedVuln
+	for _, v := range db.Vulns {
+		if affected, _ := v.Affects(goVers); affected {
+			continue
+		}
+		fv := FixedVuln{Vuln: v}
+		for _, old := range oldVersions {
+			if affected, fixedIn := v.Affects(floatingVersion(old, releases)); affected && (fv.Fixed == "" || compareSemver(fixedIn, fv.Fixed) < 0) {
+				fv.Fixed = fixedIn
+			}
+		}
+		if fv.Fixed != "" {
+			fixed = append(fixed, fv)
+		}
+	}
+	return fixed
+}
+
+// floatingVersion returns the latest of releases in the minor version of
+// pinned if pinned is just a minor version, and pinned otherwise.
+func floatingVersion(pinned string, releases []Release) string {
+	v, ok := parseGoVersion(pinned)
+	if !ok || v.parts == 3 || v.pre != "" {
+		return pinned
+	}
+	for _, r := range releases {
+		rv, ok := parseGoVersion(r.Version)
+		if ok && rv.sameMinor(v) {
+			return rv.String()
+		}
+	}
+	return pinned
+}
+
+// vulnSemver returns the semantic version that the Go vulnerability database
+// writes the Go version goVers as, like "1.21.5" for "go1.21.5", "1.21.0" for
+// "1.21", and "1.22.0-rc.1" for "1.22rc1".
+func vulnSemver(goVers string) (string, bool) {
+	v, ok := parseGoVersion(goVers)
+	if !ok {
+		return "", false
+	}
+	s := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.pre != "" {
+		kind, n := splitPrerelease(v.pre)
+		s += fmt.Sprintf("-%s.%d", kind, n)
+	}
+	return s, true
+}
+
+// compareSemver compares the semantic versions a and b, without "v"
+// prefixes, following the semver spec's precedence rules.
+func compareSemver(a, b string) int {
+	aCore, aPre := splitSemver(a)
+	bCore, bPre := splitSemver(b)
+	ac, bc := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := 0; i < 3; i++ {
+		if c := cmpInt(semverPart(ac, i), semverPart(bc, i)); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	ap, bp := strings.Split(aPre, "."), strings.Split(bPre, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, aErr := strconv.Atoi(ap[i])
+		bn, bErr := strconv.Atoi(bp[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := cmpInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			// Numeric identifiers have lower precedence than
+			// alphanumeric ones.
+			return -1
+		case bErr == nil:
+			return 1
+		case ap[i] != bp[i]:
+			if ap[i] < bp[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return cmpInt(len(ap), len(bp))
+}
+
+func splitSemver(s string) (string, string) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.Index(s, "+"); i != -1 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i != -1 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+func semverPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	n, _ := strconv.Atoi(parts[i])
+	return n
+}
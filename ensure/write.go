@@ -0,0 +1,134 @@
+package ensure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// renameFile is swapped out in tests to make renames fail.
+var renameFile = os.Rename
+
+// stagedFile is a file whose new contents have been written to a temporary
+// file next to it.
+type stagedFile struct {
+	// path is the file being replaced, with any symlinks resolved.
+	path string
+	tmp  string
+	orig []byte
+	mode os.FileMode
+}
+
+// WriteFiles writes all of the files' new contents or, as far as it can, none
+// of them. The new contents are written to temporary files in the same
+// directories as the files, given the files' permissions, and then renamed
+// over them. If writing any of the temporary files fails, none of the files
+// are changed. If renaming one fails, the files already renamed over are put
+// back to their original contents, and the ones that can't be are listed in
+// the returned error.
+func WriteFiles(contents []FileContent) error {
+	var staged []stagedFile
+	cleanup := func() {
+		for _, sf := range staged {
+			os.Remove(sf.tmp)
+		}
+	}
+	for _, fc := range contents {
+		sf, err := stageFile(fc.Path, fc.Contents)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		staged = append(staged, sf)
+	}
+
+	for i, sf := range staged {
+		err := renameFile(sf.tmp, sf.path)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("unable to write new updated contents to %#v: %s", sf.path, err)
+		cleanup()
+		// Keep restoring after a failure so that as few files as possible
+		// are left updated.
+		var failed []string
+		for _, done := range staged[:i] {
+			if rerr := restoreFile(done); rerr != nil {
+				failed = append(failed, fmt.Sprintf("%#v: %s", done.path, rerr))
+			}
+		}
+		if len(failed) != 0 {
+			return fmt.Errorf("%s, and then unable to restore the original contents of %s", err, strings.Join(failed, "; "))
+		}
+		return err
+	}
+	return nil
+}
+
+// stageFile writes contents to a temporary file next to the file at fp with the
+// same permissions.
+func stageFile(fp string, contents []byte) (stagedFile, error) {
+	// Replacing a symlink would turn it into a regular file instead of
+	// updating the file it points to.
+	path, err := filepath.EvalSymlinks(fp)
+	if err != nil {
+		return stagedFile{}, fmt.Errorf("unable to find %#v to write to: %s", fp, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return stagedFile{}, fmt.Errorf("unable to find %#v to write to: %s", fp, err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		return stagedFile{}, fmt.Errorf("unable to read original contents of %#v: %s", fp, err)
+	}
+	mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	tmp, err := writeTempFile(path, contents, mode)
+	if err != nil {
+		return stagedFile{}, fmt.Errorf("unable to write new updated contents for %#v: %s", fp, err)
+	}
+	return stagedFile{path: path, tmp: tmp, orig: orig, mode: mode}, nil
+}
+
+// writeTempFile writes contents with the given mode to a new temporary file in
+// the same directory as path, so that it can be renamed over it, and returns
+// the temporary file's path.
+func writeTempFile(path string, contents []byte, mode os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".ensure-latest-go-")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(contents)
+	if err == nil {
+		// Chmod instead of passing the mode when creating the file so that
+		// the umask doesn't change it.
+		err = f.Chmod(mode)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// restoreFile puts the original contents of a file that was already renamed
+// over back.
+func restoreFile(sf stagedFile) error {
+	tmp, err := writeTempFile(sf.path, sf.orig, sf.mode)
+	if err != nil {
+		return err
+	}
+	if err := renameFile(tmp, sf.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
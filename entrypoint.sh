@@ -2,5 +2,11 @@
 
 set -euo pipefail
 
-GO_VERSION=$(latest_go_ensurer $@)
+# action.yml passes the command input and then the other inputs as flags.
+if [ "${1:-update}" != "update" ]; then
+	# check's annotations have to reach the workflow log, and its exit
+	# status fails the step when there are out of date files.
+	exec latest_go_ensurer "$@"
+fi
+GO_VERSION=$(latest_go_ensurer "$@")
 echo "##[set-output name=go_version]$GO_VERSION"
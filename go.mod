@@ -1,6 +1,6 @@
 module github.com/jmhodges/ensure-latest-go
 
-go 1.13
+go 1.16
 
 require (
 	github.com/google/go-cmp v0.3.1
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jmhodges/ensure-latest-go/ensure"
+)
+
+// The SARIF rules that out of date pins break. Pins affected by known
+// vulnerabilities break the second one instead of the first, and pins on
+// end-of-life versions the third, whether they're being updated or not.
+const (
+	outdatedRuleID   = "outdated-go-version"
+	vulnerableRuleID = "vulnerable-go-version"
+	eolRuleID        = "eol-go-version"
+)
+
+// changeMessage describes an out of date pin for annotations and SARIF
+// results.
+func changeMessage(c ensure.Change) string {
+	msg := fmt.Sprintf("Go %s is out of date and would be updated to Go %s.", c.Version, c.NewVersion)
+	if c.Version == "" {
+		msg = fmt.Sprintf("No Go version is pinned here. It would be pinned to Go %s.", c.NewVersion)
+	}
+	if len(c.Vulns) != 0 {
+		var ids []string
+		for _, v := range c.Vulns {
+			id := v.ID
+			if len(v.Aliases) != 0 {
+				id += " (" + strings.Join(v.Aliases, ", ") + ")"
+			}
+			ids = append(ids, id)
+		}
+		msg += fmt.Sprintf(" It's affected by %s.", strings.Join(ids, ", "))
+	}
+	if c.Support == ensure.SupportEOL {
+		msg += " It's end-of-life and no longer gets security fixes."
+	}
+	return msg
+}
+
+// unsupportedMessage describes a pin on an end-of-life version that isn't
+// being updated to a supported one. minors are the supported minor versions.
+func unsupportedMessage(p ensure.UnsupportedPin, minors []string) string {
+	msg := fmt.Sprintf("Go %s is end-of-life and no longer gets security fixes. Go only supports %s.", p.Version, strings.Join(minors, " and "))
+	if p.Kept {
+		return msg + " Updating adds newer versions to this list of versions instead of replacing this one, so remove it if it's no longer needed."
+	}
+	return msg + " The policy for this file doesn't update it to a supported version."
+}
+
+// unsupportedEnd returns the line and column where the version of an
+// unsupported pin ends, exclusive.
+func unsupportedEnd(p ensure.UnsupportedPin) (int, int) {
+	return p.Line, p.Column + utf8.RuneCountInString(p.Version)
+}
+
+// changeSeverity returns the annotation level of an out of date pin, which is
+// also its SARIF level, and its SARIF rule.
+func changeSeverity(c ensure.Change) (string, string) {
+	switch {
+	case len(c.Vulns) != 0:
+		return "error", vulnerableRuleID
+	case c.Support == ensure.SupportEOL:
+		return "error", eolRuleID
+	}
+	return "warning", outdatedRuleID
+}
+
+// ruleTitles are the titles of the annotations for each SARIF rule.
+var ruleTitles = map[string]string{
+	outdatedRuleID:   "Out of date Go version",
+	vulnerableRuleID: "Vulnerable Go version",
+	eolRuleID:        "End-of-life Go version",
+}
+
+// printAnnotations writes a GitHub Actions ::warning workflow command for
+// each out of date pin, or ::error for vulnerable and end-of-life ones, so
+// they show up inline in pull requests. The unsupported pins, which aren't
+// being updated, are always errors.
+func printAnnotations(w io.Writer, root string, contents []ensure.FileContent, unsupported []ensure.UnsupportedPin, minors []string) {
+	for _, fc := range contents {
+		for _, c := range fc.Changes {
+			level, rule := changeSeverity(c)
+			fmt.Fprintf(w, "::%s file=%s,line=%d,col=%d,endLine=%d,endColumn=%d,title=%s::%s\n",
+				level, escapeProperty(relPath(root, fc.Path)), c.Line, c.Column, c.EndLine, c.EndColumn,
+				escapeProperty(ruleTitles[rule]), escapeData(changeMessage(c)))
+		}
+	}
+	for _, p := range unsupported {
+		endLine, endCol := unsupportedEnd(p)
+		fmt.Fprintf(w, "::error file=%s,line=%d,col=%d,endLine=%d,endColumn=%d,title=%s::%s\n",
+			escapeProperty(p.Path), p.Line, p.Column, endLine, endCol,
+			escapeProperty(ruleTitles[eolRuleID]), escapeData(unsupportedMessage(p, minors)))
+	}
+}
+
+// escapeData and escapeProperty escape the message and the property values
+// of workflow commands the way the GitHub Actions toolkit does.
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// The parts of SARIF 2.1.0 that are written.
+type (
+	sarifLog struct {
+		Version string     `json:"version"`
+		Schema  string     `json:"$schema"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool       sarifTool     `json:"tool"`
+		ColumnKind string        `json:"columnKind"`
+		Results    []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID                   string            `json:"id"`
+		ShortDescription     sarifMessage      `json:"shortDescription"`
+		FullDescription      sarifMessage      `json:"fullDescription"`
+		HelpURI              string            `json:"helpUri"`
+		DefaultConfiguration map[string]string `json:"defaultConfiguration"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifLocation struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI       string `json:"uri"`
+				URIBaseID string `json:"uriBaseId"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine   int `json:"startLine"`
+				StartColumn int `json:"startColumn"`
+				EndLine     int `json:"endLine"`
+				EndColumn   int `json:"endColumn"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+)
+
+// writeSARIF writes a SARIF 2.1.0 log of the out of date and unsupported pins
+// to the file at fp for GitHub code scanning.
+func writeSARIF(fp, root string, contents []ensure.FileContent, unsupported []ensure.UnsupportedPin, minors []string) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "ensure-latest-go",
+			InformationURI: "https://github.com/jmhodges/ensure-latest-go",
+			Rules: []sarifRule{{
+				ID:                   outdatedRuleID,
+				ShortDescription:     sarifMessage{"Out of date Go version"},
+				FullDescription:      sarifMessage{"The Go version pinned here is older than the one ensure-latest-go would update it to."},
+				HelpURI:              "https://go.dev/doc/devel/release",
+				DefaultConfiguration: map[string]string{"level": "warning"},
+			}, {
+				ID:                   vulnerableRuleID,
+				ShortDescription:     sarifMessage{"Vulnerable Go version"},
+				FullDescription:      sarifMessage{"The Go version pinned here is affected by known vulnerabilities in the standard library or toolchain that a newer release fixes."},
+				HelpURI:              "https://pkg.go.dev/vuln/",
+				DefaultConfiguration: map[string]string{"level": "error"},
+			}, {
+				ID:                   eolRuleID,
+				ShortDescription:     sarifMessage{"End-of-life Go version"},
+				FullDescription:      sarifMessage{"The Go version pinned here is no longer supported. Go only supports its two newest minor versions."},
+				HelpURI:              "https://go.dev/doc/devel/release#policy",
+				DefaultConfiguration: map[string]string{"level": "error"},
+			}},
+		}},
+		ColumnKind: "unicodeCodePoints",
+		Results:    []sarifResult{},
+	}
+	for _, fc := range contents {
+		for _, c := range fc.Changes {
+			level, rule := changeSeverity(c)
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    rule,
+				Level:     level,
+				Message:   sarifMessage{changeMessage(c)},
+				Locations: []sarifLocation{newSARIFLocation(relPath(root, fc.Path), c.Line, c.Column, c.EndLine, c.EndColumn)},
+			})
+		}
+	}
+	for _, p := range unsupported {
+		endLine, endCol := unsupportedEnd(p)
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    eolRuleID,
+			Level:     "error",
+			Message:   sarifMessage{unsupportedMessage(p, minors)},
+			Locations: []sarifLocation{newSARIFLocation(p.Path, p.Line, p.Column, endLine, endCol)},
+		})
+	}
+	b, err := json.MarshalIndent(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fp, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write SARIF file %#v: %s", fp, err)
+	}
+	return nil
+}
+
+func newSARIFLocation(path string, line, col, endLine, endCol int) sarifLocation {
+	var loc sarifLocation
+	loc.PhysicalLocation.ArtifactLocation.URI = path
+	loc.PhysicalLocation.ArtifactLocation.URIBaseID = "%SRCROOT%"
+	r := &loc.PhysicalLocation.Region
+	r.StartLine, r.StartColumn, r.EndLine, r.EndColumn = line, col, endLine, endCol
+	return loc
+}
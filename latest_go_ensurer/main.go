@@ -1,183 +1,781 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
+
+	"github.com/jmhodges/ensure-latest-go/ensure"
+)
+
+// The exit codes of latest_go_ensurer.
+const (
+	exitOK    = 0
+	exitError = 1
+	// exitUsage is for unknown commands and bad flags.
+	exitUsage = 2
+	// exitOutOfDate is for the check and diff commands when there are files
+	// that would be updated.
+	exitOutOfDate = 3
+)
+
+// commands are the subcommands of latest_go_ensurer and what they do.
+var commands = []struct{ name, desc string }{
+	{"update", "update the Go versions in the repo's files and print the latest Go version (the default)"},
+	{"check", "print the files with out of date Go versions and exit with status 3 if there are any"},
+	{"list", "print the files that would be updated, and the ones excluded, with the patterns that matched them"},
+	{"diff", "print a diff of the updates without making them and exit with status 3 if there are any"},
+	{"report", "print every Go version pinned in the repo, how far behind the latest release it is, and the files that disagree"},
+}
+
+// getReleases, getReleaseNotes, and writeFiles are swapped out in tests.
+var (
+	getReleases                               = ensure.GetReleases
+	getReleaseNotes ensure.ReleaseNotesSource = ensure.GetReleaseNotes
+	writeFiles                                = ensure.WriteFiles
 )
 
 func main() {
-	excludeFiles := os.Getenv("INPUT_EXCLUDES")
-	excluded := make(map[string]bool)
-	for _, ef := range strings.Split(excludeFiles, ",") {
-		ef := abs(ef)
-		excluded[ef] = true
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// options are the flags shared by all of the commands. Each flag defaults to
+// the environment variable that the GitHub Action would set its input in,
+// like INPUT_DOCKERFILES, so the action's inputs work even if they aren't
+// passed as flags.
+type options struct {
+	root           string
+	config         string
+	exclude        string
+	bazelChecksums bool
+	printConfig    bool
+	// format is the report command's output format.
+	format string
+	// annotate and sarif are where check reports the out of date pins
+	// besides its list of files.
+	annotate bool
+	sarif    string
+
+	// commit makes update create a branch and commit the updated files to it.
+	commit        bool
+	branch        string
+	commitMessage string
+	gitAuthor     string
+	remote        string
+	push          bool
+
+	// pullRequest makes update open a pull request from the branch, or
+	// update the one it opened for an earlier release.
+	pullRequest  bool
+	prTitle      string
+	prBody       string
+	labels       string
+	reviewers    string
+	base         string
+	repository   string
+	githubAPIURL string
+
+	changelogTemplate string
+	// vulnDB is where the Go vulnerability database is read from.
+	vulnDB string
+
+	// httpTimeout, httpRetries, cacheDir, cacheTTL, and caBundle configure
+	// the requests for the releases, release history, and vulnerability
+	// database. The numbers are parsed by httpOptions so that bad values in
+	// the action's inputs are reported like bad flags are.
+	httpTimeout string
+	httpRetries string
+	cacheDir    string
+	cacheTTL    string
+	caBundle    string
+	// patterns are the values of the updaters' pattern flags by the flags'
+	// names.
+	patterns map[string]*string
+}
+
+func newFlagSet(cmd string, stderr io.Writer, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("latest_go_ensurer "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: latest_go_ensurer [command] [flags] [paths...]\n\nCommands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(stderr, "  %-7s %s\n", c.name, c.desc)
+		}
+		fmt.Fprintf(stderr, "\nPaths limit the command to the files at or under them.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.root, "root", ".", "the top-level directory of the repo to update")
+	fs.StringVar(&opts.config, "config", envDefault("config", ensure.DefaultConfigFile), "the path, relative to the root, of the config file")
+	fs.StringVar(&opts.exclude, "exclude", excludeEnv(), "comma-separated glob patterns of files to never update")
+	fs.BoolVar(&opts.bazelChecksums, "bazelchecksums", envDefault("bazelchecksums", "") == "true", "update the SDK checksums in Bazel files along with their versions")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "print the effective config, with all defaults filled in, and exit")
+	fs.StringVar(&opts.format, "format", "text", "for report, the output format: text, json, or markdown")
+	fs.BoolVar(&opts.annotate, "annotate", os.Getenv("GITHUB_ACTIONS") == "true", "for check, print a GitHub Actions ::warning command for each out of date Go version (default true in GitHub Actions)")
+	fs.StringVar(&opts.sarif, "sarif", envDefault("sarif", ""), "for check, the path to write a SARIF 2.1.0 file of the out of date Go versions to, for GitHub code scanning")
+	fs.BoolVar(&opts.commit, "commit", envDefault("commit", "") == "true", "for update, create a branch and commit the updated files to it, unless the branch already exists on the remote")
+	fs.StringVar(&opts.branch, "branch", envDefault("branch", ensure.DefaultBranchTemplate), "for update with -commit, the template of the branch to create")
+	fs.StringVar(&opts.commitMessage, "commitmessage", envDefault("commitmessage", ensure.DefaultCommitMessageTemplate), "for update with -commit, the template of the commit message")
+	fs.StringVar(&opts.gitAuthor, "gitauthor", envDefault("gitauthor", ""), "for update with -commit, the \"Name <email>\" to commit as instead of the repo's git user")
+	fs.StringVar(&opts.remote, "remote", envDefault("remote", "origin"), "for update with -commit, the git remote to look for the branch on and push it to")
+	fs.BoolVar(&opts.push, "push", envDefault("push", "") == "true", "for update with -commit, push the branch to the remote")
+	fs.BoolVar(&opts.pullRequest, "pullrequest", envDefault("pullrequest", "") == "true", "for update, commit and push the updated files and open a pull request for them, or update the open one from an earlier release")
+	fs.StringVar(&opts.prTitle, "prtitle", envDefault("prtitle", ""), "for update with -pullrequest, the template of the pull request's title (default the commit message)")
+	fs.StringVar(&opts.prBody, "prbody", envDefault("prbody", ""), "for update with -pullrequest, the template of the pull request's body (default a list of the updated files)")
+	fs.StringVar(&opts.labels, "labels", envDefault("labels", ""), "for update with -pullrequest, comma-separated labels to add to the pull request")
+	fs.StringVar(&opts.reviewers, "reviewers", envDefault("reviewers", ""), "for update with -pullrequest, comma-separated users and org/team teams to request reviews from")
+	fs.StringVar(&opts.base, "base", envDefault("base", ""), "for update with -pullrequest, the branch to merge the pull request into (default the checked out branch)")
+	fs.StringVar(&opts.repository, "repository", os.Getenv("GITHUB_REPOSITORY"), "for update with -pullrequest, the owner/name of the GitHub repo to open the pull request in")
+	fs.StringVar(&opts.githubAPIURL, "githubapiurl", githubAPIURLEnv(), "for update with -pullrequest, the base URL of the GitHub REST API, for GitHub Enterprise Server")
+	fs.StringVar(&opts.changelogTemplate, "changelogtemplate", envDefault("changelogtemplate", ""), "for update, the template of the markdown changelog of the releases being updated past (default a list of them with their release notes)")
+	fs.StringVar(&opts.vulnDB, "vulndb", envDefault("vulndb", ""), "the URL or local directory of an OSV database laid out like the Go vulnerability database, for the security policy, check's severities, and the changelog (default "+ensure.DefaultVulnDB+" if a config rule has the security policy, and none otherwise)")
+	fs.StringVar(&opts.httpTimeout, "httptimeout", envDefault("httptimeout", ensure.DefaultHTTPTimeout.String()), "how long each attempt at getting the Go releases, release history, or vulnerability database can take")
+	fs.StringVar(&opts.httpRetries, "httpretries", envDefault("httpretries", strconv.Itoa(ensure.DefaultHTTPRetries)), "how many times to retry getting the Go releases, release history, or vulnerability database when the network or server fails")
+	fs.StringVar(&opts.cacheDir, "cachedir", envDefault("cachedir", defaultCacheDir()), "the directory to cache the Go releases, release history, and vulnerability database in, or empty to not cache them")
+	fs.StringVar(&opts.cacheTTL, "cachettl", envDefault("cachettl", ensure.DefaultCacheTTL.String()), "how old cached responses can be and still be used when the network is down")
+	fs.StringVar(&opts.caBundle, "cabundle", envDefault("cabundle", ""), "the path of a PEM file of certificate authorities to trust on top of the system's, like a TLS-intercepting proxy's")
+	opts.patterns = make(map[string]*string)
+	for _, u := range ensure.DefaultUpdaters(false) {
+		input := inputName(u)
+		opts.patterns[input] = fs.String(input, envDefault(input, ""), fmt.Sprintf("comma-separated glob patterns of the %ss to update instead of the default ones", u.Description()))
+	}
+	return fs
+}
+
+func envDefault(input, def string) string {
+	if v := strings.TrimSpace(os.Getenv("INPUT_" + strings.ToUpper(input))); v != "" {
+		return v
+	}
+	return def
+}
+
+// excludeEnv returns the default of the exclude flag.
+func excludeEnv() string {
+	input := os.Getenv("INPUT_EXCLUDE")
+	if input == "" {
+		// Older versions of this tool read INPUT_EXCLUDES, which the
+		// exclude input is never passed as, but people running the tool by
+		// hand might be setting it.
+		input = os.Getenv("INPUT_EXCLUDES")
 	}
+	return input
+}
 
-	dockerfiles := gatherDockerfiles(excluded)
-	travisfiles := gatherTravisfiles(excluded)
-	actionVersion, err := gatherGitHubActionGoVersion(excluded)
+// defaultCacheDir returns the default of the cachedir flag, which is in the
+// user's cache directory, or nothing if there isn't one.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
 	if err != nil {
-		log.Fatalf("latest_go_ensurer: unable to parse .github/versions/go: %s", err)
+		return ""
+	}
+	return filepath.Join(dir, "ensure-latest-go")
+}
+
+// httpOptions parses the flags for the HTTP client. Log messages about
+// retries and the cache go to logger.
+func httpOptions(opts *options, logger *log.Logger) (ensure.HTTPOptions, error) {
+	// The GitHub Action passes its inputs as flags even when they're empty,
+	// so empty values are the defaults.
+	timeout, retries, ttl := ensure.DefaultHTTPTimeout, ensure.DefaultHTTPRetries, ensure.DefaultCacheTTL
+	var err error
+	if opts.httpTimeout != "" {
+		timeout, err = time.ParseDuration(opts.httpTimeout)
+		if err != nil || timeout <= 0 {
+			return ensure.HTTPOptions{}, fmt.Errorf("httptimeout must be a positive duration like \"30s\", not %#v", opts.httpTimeout)
+		}
+	}
+	if opts.httpRetries != "" {
+		retries, err = strconv.Atoi(opts.httpRetries)
+		if err != nil || retries < 0 {
+			return ensure.HTTPOptions{}, fmt.Errorf("httpretries must be a number of at least 0, not %#v", opts.httpRetries)
+		}
+	}
+	if opts.cacheTTL != "" {
+		ttl, err = time.ParseDuration(opts.cacheTTL)
+		if err != nil || ttl <= 0 {
+			return ensure.HTTPOptions{}, fmt.Errorf("cachettl must be a positive duration like \"24h\", not %#v", opts.cacheTTL)
+		}
 	}
+	return ensure.HTTPOptions{
+		Timeout:  timeout,
+		Retries:  retries,
+		CacheDir: opts.cacheDir,
+		CacheTTL: ttl,
+		CABundle: opts.caBundle,
+		Logf: func(format string, args ...interface{}) {
+			logger.Printf("latest_go_ensurer: "+format, args...)
+		},
+	}, nil
+}
 
-	if len(dockerfiles)+len(travisfiles) == 0 && actionVersion == "" {
-		log.Fatalf("latest_go_ensurer: no files given to update. Set the dockerfiles, or travisfiles arguments in your GitHub Action workflow or add .github/versions/go to your repo")
+// githubAPIURLEnv returns the default of the githubapiurl flag. GitHub Actions
+// sets GITHUB_API_URL to the API of the GitHub instance the workflow is
+// running in.
+func githubAPIURLEnv() string {
+	if u := os.Getenv("GITHUB_API_URL"); u != "" {
+		return u
 	}
+	return ensure.DefaultGitHubAPIURL
+}
 
-	goVers, err := getLatestGoVersion()
+// githubToken returns the token to use with the GitHub API. The action's token
+// input defaults to the workflow's GITHUB_TOKEN.
+func githubToken() string {
+	if token := os.Getenv("INPUT_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
+
+// splitList splits a comma-separated flag value into its trimmed, non-empty
+// elements.
+func splitList(s string) []string {
+	var out []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// run runs the command in args and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	logger := log.New(stderr, "", log.LstdFlags)
+	fatalf := func(format string, args ...interface{}) int {
+		logger.Printf("latest_go_ensurer: "+format, args...)
+		return exitError
+	}
+
+	cmd := "update"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	known := false
+	for _, c := range commands {
+		known = known || c.name == cmd
+	}
+	opts := &options{}
+	fs := newFlagSet(cmd, stderr, opts)
+	// -list-files is what the list command was before there were commands.
+	listFiles := fs.Bool("list-files", false, "the same as the list command")
+	if !known {
+		fmt.Fprintf(stderr, "latest_go_ensurer: unknown command %#v\n", cmd)
+		fs.Usage()
+		return exitUsage
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *listFiles {
+		cmd = "list"
+	}
+	if !containsString(reportFormats, opts.format) {
+		fmt.Fprintf(stderr, "latest_go_ensurer: unknown format %#v, must be one of %s\n", opts.format, strings.Join(reportFormats, ", "))
+		return exitUsage
+	}
+	httpOpts, err := httpOptions(opts, logger)
 	if err != nil {
-		log.Fatalf("latest_go_ensurer: %s", err)
+		fmt.Fprintf(stderr, "latest_go_ensurer: %s\n", err)
+		return exitUsage
+	}
+	if opts.pullRequest {
+		opts.commit, opts.push = true, true
+		if opts.repository == "" {
+			return fatalf("the repository flag, or GITHUB_REPOSITORY, is required to open a pull request")
+		}
 	}
 
-	fmt.Println(goVers) // for set-output in the GitHub Action
+	client, err := ensure.NewHTTPClient(httpOpts)
+	if err != nil {
+		return fatalf("%s", err)
+	}
 
-	// Check that we can read and parse all of the files before writing changes
-	// back to the file system. This won't avoid all partial write problems, but
-	// it'll avoid obvious stuff.
-	dockerContents, err := updateDockerfiles(dockerfiles, goVers)
+	updaters := ensure.DefaultUpdaters(opts.bazelChecksums)
+	root := abs(opts.root)
+	configPath := opts.config
+	if configPath == "" {
+		configPath = ensure.DefaultConfigFile
+	}
+	if !filepath.IsAbs(configPath) {
+		configPath = filepath.Join(root, configPath)
+	}
+	cfg, err := ensure.LoadConfig(configPath, ensure.Names(updaters))
 	if err != nil {
-		log.Fatalf("latest_go_ensurer: %s", err)
+		return fatalf("%s", err)
+	}
+	if opts.printConfig {
+		fmt.Fprint(stdout, cfg.Effective())
+		return exitOK
 	}
 
-	travisContents, err := updateTravisFiles(travisfiles, goVers)
+	excludes, err := ensure.ParseInputPatterns(root, opts.exclude)
+	if err != nil {
+		return fatalf("bad exclude flag: %s", err)
+	}
+	var onlyPaths []string
+	for _, p := range fs.Args() {
+		onlyPaths = append(onlyPaths, ensure.NormalizeInputPath(root, abs(p)))
+	}
+	repoFiles, err := ensure.DiscoverFiles(root)
 	if err != nil {
-		log.Fatalf("latest_go_ensurer: %s", err)
+		return fatalf("unable to list the files in the repo: %s", err)
 	}
 
-	var actionContents []fileContent
-	if actionVersion != "" {
-		var err error
-		actionContents, err = updateGitHubActionVersionFile(ghActionVersionFile, actionVersion, goVers)
+	paths := make([][]string, len(updaters))
+	var numPaths int
+	var inputs []string
+	var allMatches []ensure.FileMatch
+	for i, u := range updaters {
+		matches, err := gatherFiles(u, root, repoFiles, opts, excludes)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+		for _, m := range matches {
+			if !underAny(m.Path, onlyPaths) {
+				continue
+			}
+			allMatches = append(allMatches, m)
+			if m.ExcludedBy == "" {
+				paths[i] = append(paths[i], filepath.Join(root, filepath.FromSlash(m.Path)))
+			}
+		}
+		numPaths += len(paths[i])
+		inputs = append(inputs, inputName(u))
+	}
+	if cmd == "list" {
+		err := printFileMatches(stdout, allMatches, cfg)
 		if err != nil {
-			log.Fatalf("latest_go_ensurer: %s", err)
+			return fatalf("unable to print the file list: %s", err)
 		}
+		return exitOK
+	}
+	if cmd == "report" {
+		// go.mod files are never updated, but they're what the other files
+		// usually ought to agree with.
+		goMod := ensure.GoModPinner{}
+		matches, err := gatherFiles(goMod, root, repoFiles, opts, excludes)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+		var goModPaths []string
+		for _, m := range matches {
+			if m.ExcludedBy == "" && underAny(m.Path, onlyPaths) {
+				goModPaths = append(goModPaths, filepath.Join(root, filepath.FromSlash(m.Path)))
+			}
+		}
+		pins, err := ensure.ReadPins(goMod, root, goModPaths)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+		for i, u := range updaters {
+			found, err := ensure.ReadPins(u, root, paths[i])
+			if err != nil {
+				return fatalf("%s", err)
+			}
+			pins = append(pins, found...)
+		}
+		releases, err := getReleases(client)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+		if err := printReport(stdout, opts.format, pins, releases); err != nil {
+			return fatalf("unable to print the report: %s", err)
+		}
+		return exitOK
+	}
+	if numPaths == 0 {
+		return fatalf("no files given to update. Set the %s arguments in your GitHub Action workflow or add .github/versions/go to your repo", strings.Join(inputs, ", "))
 	}
 
-	var contents []fileContent
-	contents = append(contents, dockerContents...)
-	contents = append(contents, travisContents...)
-	contents = append(contents, actionContents...)
+	releases, err := getReleases(client)
+	if err != nil {
+		return fatalf("%s", err)
+	}
+	ts := ensure.Targets{Config: cfg, Root: root, Releases: releases}
+	vulnDB := opts.vulnDB
+	if vulnDB == "" && usesPolicy(cfg, ensure.PolicySecurity) {
+		vulnDB = ensure.DefaultVulnDB
+	}
+	if vulnDB != "" {
+		ts.Vulns, err = ensure.LoadVulnDB(client, vulnDB)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+	}
 
+	// Check that we can read and parse all of the files before writing changes
+	// back to the file system. WriteFiles rolls back the ones it's written if
+	// it can't write them all, but this avoids getting that far for the
+	// obvious stuff.
+	contents, err := ensure.UpdateAllFiles(updaters, paths, ts)
+	if err != nil {
+		return fatalf("%s", err)
+	}
 	sort.Slice(contents, func(i, j int) bool {
-		return contents[i].origFP < contents[j].origFP
+		return contents[i].Path < contents[j].Path
 	})
+	// Pins on end-of-life versions that won't be updated to supported ones,
+	// like the older entries of Travis CI matrices, are called out on their
+	// own since they're never part of the files' changes.
+	var unsupported []ensure.UnsupportedPin
+	for i, u := range updaters {
+		found, err := ensure.UnsupportedPins(u, paths[i], ts)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+		unsupported = append(unsupported, found...)
+	}
+	minors := ensure.SupportedMinors(releases)
+
+	switch cmd {
+	case "check":
+		var outOfDate []string
+		for _, fc := range contents {
+			outOfDate = append(outOfDate, relPath(root, fc.Path))
+		}
+		for _, p := range unsupported {
+			if !containsString(outOfDate, p.Path) {
+				outOfDate = append(outOfDate, p.Path)
+			}
+		}
+		sort.Strings(outOfDate)
+		for _, p := range outOfDate {
+			fmt.Fprintln(stdout, p)
+		}
+		if opts.annotate {
+			printAnnotations(stdout, root, contents, unsupported, minors)
+		}
+		if opts.sarif != "" {
+			if err := writeSARIF(opts.sarif, root, contents, unsupported, minors); err != nil {
+				return fatalf("%s", err)
+			}
+		}
+		if len(outOfDate) != 0 {
+			return exitOutOfDate
+		}
+		return exitOK
+	case "diff":
+		for _, fc := range contents {
+			orig, err := ioutil.ReadFile(fc.Path)
+			if err != nil {
+				return fatalf("unable to read %#v: %s", fc.Path, err)
+			}
+			fmt.Fprint(stdout, unifiedDiff(relPath(root, fc.Path), orig, fc.Contents))
+		}
+		if len(contents) != 0 {
+			return exitOutOfDate
+		}
+		return exitOK
+	}
+
+	goVers := releases[0].Version[len("go"):]
+	data := ensure.TemplateData{GoVersion: goVers}
 	for _, fc := range contents {
-		err := ioutil.WriteFile(fc.origFP, fc.contentsToWrite, 0644)
+		data.Files = append(data.Files, relPath(root, fc.Path))
+		for _, v := range fc.OldVersions() {
+			if !containsString(data.OldVersions, v) {
+				data.OldVersions = append(data.OldVersions, v)
+			}
+		}
+	}
+	if len(contents) != 0 {
+		data.Changelog, err = changelog(logger, client, releases, ts.Vulns, data, opts.changelogTemplate)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+	}
+
+	var repo ensure.GitRepo
+	var branch, message string
+	// pushBranch is the branch on the remote that's pushed to, which is an
+	// earlier release's branch when its pull request is being updated.
+	var pushBranch string
+	var gh *ensure.GitHub
+	var pr *ensure.PullRequest
+	var base string
+	if opts.commit && len(contents) != 0 {
+		branch, err = ensure.ExecuteTemplate("branch", opts.branch, data)
+		if err != nil {
+			return fatalf("%s", err)
+		}
+		message, err = ensure.ExecuteTemplate("commit message", opts.commitMessage, data)
 		if err != nil {
-			log.Fatalf("latest_go_ensurer: unable to write new updated contents to %#v: %s", fc.origFP, err)
+			return fatalf("%s", err)
+		}
+		repo = ensure.GitRepo{Dir: root}
+		pushBranch = branch
+		if opts.pullRequest {
+			base = opts.base
+			if base == "" {
+				base, err = repo.CurrentBranch()
+				if err != nil {
+					return fatalf("unable to find the branch to open the pull request against, so set the base flag: %s", err)
+				}
+			}
+			gh = &ensure.GitHub{BaseURL: opts.githubAPIURL, Token: githubToken(), Client: client.Client()}
+			pr, err = gh.FindPullRequest(opts.repository, base)
+			if err != nil {
+				return fatalf("unable to look for an existing pull request: %s", err)
+			}
+		}
+		if pr != nil {
+			if v, _ := pr.Version(); v == goVers {
+				logger.Printf("latest_go_ensurer: pull request %s already updates to Go %s, so not updating any files", pr.HTMLURL, goVers)
+				fmt.Fprintln(stdout, goVers)
+				return exitOK
+			}
+			pushBranch = pr.Head.Ref
+		} else {
+			exists, err := repo.RemoteBranchExists(opts.remote, branch)
+			if err != nil {
+				return fatalf("unable to check for branch %#v on %s: %s", branch, opts.remote, err)
+			}
+			if exists {
+				logger.Printf("latest_go_ensurer: branch %#v already exists on %s, so not updating any files", branch, opts.remote)
+				fmt.Fprintln(stdout, goVers)
+				return exitOK
+			}
+		}
+	}
+
+	// The files are written before the branch is created so that failing to
+	// write them doesn't leave the checkout on a new branch with nothing
+	// committed to it.
+	if err := writeFiles(contents); err != nil {
+		return fatalf("%s", err)
+	}
+	if branch != "" {
+		if err := repo.CreateBranch(branch); err != nil {
+			return fatalf("the files were updated but the branch to commit them to couldn't be created: %s", err)
+		}
+	}
+	for _, p := range unsupported {
+		// The files have been updated as far as they're going to be.
+		p.Version = p.NewVersion
+		logger.Printf("latest_go_ensurer: warning: %s in %s: %s", p.Location(), p.Type, unsupportedMessage(p, minors))
+	}
+	if branch != "" {
+		var paths []string
+		for _, fc := range contents {
+			paths = append(paths, fc.Path)
+		}
+		if err := repo.CommitFiles(paths, message, opts.gitAuthor); err != nil {
+			return fatalf("%s", err)
+		}
+		if opts.push {
+			if pushBranch != branch {
+				err = repo.ForcePush(opts.remote, branch, pushBranch)
+			} else {
+				err = repo.Push(opts.remote, branch)
+			}
+			if err != nil {
+				return fatalf("%s", err)
+			}
+		}
+	}
+	if gh != nil {
+		if err := openPullRequest(logger, gh, pr, opts, base, pushBranch, message, data); err != nil {
+			return fatalf("%s", err)
 		}
 	}
+	if err := setActionOutput("changelog", data.Changelog); err != nil {
+		return fatalf("%s", err)
+	}
+	fmt.Fprintln(stdout, goVers) // for set-output in the GitHub Action
+	return exitOK
+}
+
+// changelog returns the markdown changelog of the releases between the
+// versions in data. The release history only adds detail to it, so it's left
+// out if it can't be gotten.
+func changelog(logger *log.Logger, client *ensure.HTTPClient, releases []ensure.Release, vulns *ensure.VulnDB, data ensure.TemplateData, tmpl string) (string, error) {
+	notes, err := getReleaseNotes(client)
+	if err != nil {
+		logger.Printf("latest_go_ensurer: leaving the release notes out of the changelog: %s", err)
+	}
+	if tmpl == "" {
+		tmpl = ensure.DefaultChangelogTemplate
+	}
+	return ensure.NewChangelog(releases, notes, vulns, data.OldVersions, data.GoVersion).Markdown(tmpl)
 }
 
-type fileContent struct {
-	origFP          string
-	contentsToWrite []byte
+// usesPolicy reports whether any of the config's rules have the policy.
+func usesPolicy(cfg *ensure.Config, policy string) bool {
+	for _, r := range cfg.Effective().Rules {
+		if r.Policy == policy {
+			return true
+		}
+	}
+	return false
 }
 
-func getLatestGoVersion() (string, error) {
-	client := http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Get("https://golang.org/dl/?mode=json")
+// setActionOutput sets the GitHub Action's output by appending it to the
+// file GitHub Actions names in GITHUB_OUTPUT. It does nothing outside of
+// GitHub Actions.
+func setActionOutput(name, value string) error {
+	fp := os.Getenv("GITHUB_OUTPUT")
+	if fp == "" {
+		return nil
+	}
+	// Multiline values are written as heredocs whose delimiter can't appear
+	// in the value.
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	delim := "ensure_latest_go_" + hex.EncodeToString(b)
+	f, err := os.OpenFile(fp, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 	if err != nil {
-		return "", fmt.Errorf("unable to get list of Go releases from the golang.org/dl API: %s", err)
+		return fmt.Errorf("unable to open GitHub Actions output file %#v: %s", fp, err)
+	}
+	_, err = fmt.Fprintf(f, "%s<<%s\n%s\n%s\n", name, delim, strings.TrimRight(value, "\n"), delim)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-	b, err := ioutil.ReadAll(resp.Body)
-	defer resp.Body.Close()
 	if err != nil {
-		return "", fmt.Errorf("unable to read body golang.org/dl API response: %s", err)
+		return fmt.Errorf("unable to write GitHub Actions output %s: %s", name, err)
 	}
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("golang.org/dl API returned HTTP status code %d instead of a 200", resp.StatusCode)
+	return nil
+}
+
+// openPullRequest opens a pull request from the pushed branch, or updates pr,
+// the open one from an earlier release, and then adds the labels and
+// reviewers to it.
+func openPullRequest(logger *log.Logger, gh *ensure.GitHub, pr *ensure.PullRequest, opts *options, base, head, message string, data ensure.TemplateData) error {
+	title := strings.SplitN(message, "\n", 2)[0]
+	if opts.prTitle != "" {
+		var err error
+		title, err = ensure.ExecuteTemplate("pull request title", opts.prTitle, data)
+		if err != nil {
+			return err
+		}
+	}
+	bodyTmpl := opts.prBody
+	if bodyTmpl == "" {
+		bodyTmpl = ensure.DefaultPullRequestBodyTemplate
 	}
-	var releases []goRelease
-	err = json.Unmarshal(b, &releases)
+	body, err := ensure.ExecuteTemplate("pull request body", bodyTmpl, data)
 	if err != nil {
-		return "", fmt.Errorf("unable to JSON parse golang.org/dl API response: %s", err)
+		return err
 	}
-	for _, rel := range releases {
-		if rel.Stable {
-			return rel.Version[len("go"):], nil
+	// The marker is how the pull request is found when the next release
+	// comes out.
+	body = strings.TrimRight(body, "\n") + "\n\n" + ensure.PullRequestMarker(data.GoVersion) + "\n"
+	if pr == nil {
+		pr, err = gh.CreatePullRequest(opts.repository, head, base, title, body)
+		if err != nil {
+			return fmt.Errorf("unable to open pull request: %s", err)
 		}
+		logger.Printf("latest_go_ensurer: opened pull request %s", pr.HTMLURL)
+	} else {
+		number := pr.Number
+		pr, err = gh.UpdatePullRequest(opts.repository, number, title, body)
+		if err != nil {
+			return fmt.Errorf("unable to update pull request #%d: %s", number, err)
+		}
+		logger.Printf("latest_go_ensurer: updated pull request %s", pr.HTMLURL)
+	}
+	if err := gh.AddLabels(opts.repository, pr.Number, splitList(opts.labels)); err != nil {
+		return fmt.Errorf("unable to add labels to pull request #%d: %s", pr.Number, err)
+	}
+	if err := gh.RequestReviewers(opts.repository, pr.Number, splitList(opts.reviewers)); err != nil {
+		return fmt.Errorf("unable to request reviewers of pull request #%d: %s", pr.Number, err)
 	}
-	return "", fmt.Errorf("no stable release found in golang.org/dl API response")
+	return nil
 }
 
-type goRelease struct {
-	Version string `json:"version"`
-	Stable  bool   `json:"stable"`
+// inputName returns the name of the GitHub Action input, and the flag, with
+// the glob patterns that override which files the updater updates.
+func inputName(u ensure.Pinner) string {
+	if u.Name() == "dockerfile" {
+		return "dockerfiles"
+	}
+	return u.Name() + "files"
 }
 
-func abs(fp string) string {
-	out, err := filepath.Abs(filepath.Clean(fp))
+// gatherFiles returns the files for the updater from its flag, if it's set,
+// or its default patterns if it's not.
+func gatherFiles(u ensure.Pinner, root string, repoFiles []string, opts *options, excludes ensure.GlobList) ([]ensure.FileMatch, error) {
+	input := inputName(u)
+	var flagValue string
+	if p, ok := opts.patterns[input]; ok {
+		flagValue = *p
+	}
+	patterns, err := ensure.ParseInputPatterns(root, flagValue)
 	if err != nil {
-		log.Fatalf("latest_go_ensurer: unable to get absolute path of %#v: %s", fp, err)
+		return nil, fmt.Errorf("bad %s flag: %s", input, err)
 	}
-	return out
+	return ensure.GatherFiles(u, repoFiles, input, patterns, excludes), nil
 }
 
-func gatherDockerfiles(excluded map[string]bool) map[string]bool {
-	dockerfilesInput := strings.TrimSpace(os.Getenv("INPUT_DOCKERFILES"))
-	var dockerpaths []string
-	if len(dockerfilesInput) != 0 {
-		dockerpaths = strings.Split(dockerfilesInput, ",")
-	} else {
-		filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
-			if info.Name() == "Dockerfile" {
-				dockerpaths = append(dockerpaths, path)
-			}
-			return nil
-		})
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
 	}
-	return uniqUnexcludedPaths(dockerpaths, excluded)
+	return false
 }
 
-func gatherTravisfiles(excluded map[string]bool) map[string]bool {
-	travisfilesInput := strings.TrimSpace(os.Getenv("INPUT_TRAVISFILES"))
-	var travispaths []string
-	if len(travisfilesInput) != 0 {
-		travispaths = strings.Split(travisfilesInput, ",")
-	} else {
-		fp := ".travis.yml"
-		_, err := os.Stat(fp)
-		if err == nil {
-			travispaths = append(travispaths, fp)
+// underAny reports whether the slash-separated path relPath is one of paths
+// or inside of one of them. Every path is under an empty list of paths.
+func underAny(relPath string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if p == "." || relPath == p || strings.HasPrefix(relPath, p+"/") {
+			return true
 		}
 	}
-	return uniqUnexcludedPaths(travispaths, excluded)
+	return false
 }
 
-const ghActionVersionFile = ".github/versions/go"
-
-func gatherGitHubActionGoVersion(excluded map[string]bool) (string, error) {
-	if excluded[ghActionVersionFile] {
-		return "", nil
-	}
-	b, err := ioutil.ReadFile(ghActionVersionFile)
-	if os.IsNotExist(err) {
-		return "", nil
+// printFileMatches writes a table of the given files, whether each will be
+// updated, and why, for the list command.
+func printFileMatches(w io.Writer, matches []ensure.FileMatch, cfg *ensure.Config) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tFILE\tSTATUS\tREASON")
+	for _, m := range matches {
+		status, reason := "included", "matched "+m.Reason
+		if m.ExcludedBy != "" {
+			status, reason = "excluded", fmt.Sprintf("matched %s but also exclude pattern %#v", m.Reason, m.ExcludedBy)
+		} else if cfg.RuleFor(m.Type, m.Path).Policy == ensure.PolicySkip {
+			status, reason = "skipped", fmt.Sprintf("matched %s but its config rule has the %#v policy", m.Reason, ensure.PolicySkip)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Type, m.Path, status, reason)
 	}
+	return tw.Flush()
+}
+
+// relPath returns the slash-separated path of the file at the absolute path
+// fp relative to root.
+func relPath(root, fp string) string {
+	rel, err := filepath.Rel(root, fp)
 	if err != nil {
-		return "", nil
+		return fp
 	}
-	return string(bytes.TrimSpace(b)), nil
+	return filepath.ToSlash(rel)
 }
 
-func uniqUnexcludedPaths(paths []string, excluded map[string]bool) map[string]bool {
-	files := make(map[string]bool)
-	for _, fp := range paths {
-		fp = abs(fp)
-		if fp == "" || excluded[fp] {
-			continue
-		}
-		files[fp] = true
+func abs(fp string) string {
+	out, err := filepath.Abs(filepath.Clean(fp))
+	if err != nil {
+		log.Fatalf("latest_go_ensurer: unable to get absolute path of %#v: %s", fp, err)
 	}
-	return files
+	return out
 }
@@ -1,175 +1,533 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/jmhodges/ensure-latest-go/ensure"
 )
 
-func TestDockerfileFromUpdate(t *testing.T) {
-	testcases := []struct {
-		origLine    string
-		newImageTag string
-		expected    string
-	}{
-		{
-			"from golangadf aa",
-			"1.13",
-			"from golangadf aa",
-		},
-		{
-			"from    golang:1.1.1 aa",
-			"1.13.1",
-			"from    golang:1.13.1 aa",
-		},
-		{
-			"from golang",
-			"1.2",
-			"from golang:1.2",
-		},
-		{
-			"from golang # foobar",
-			"1.2",
-			"from golang:1.2 # foobar",
-		},
-		{
-			"from golang# foobar",
-			"1.2",
-			"from golang:1.2# foobar",
-		},
-		{
-			"FROM    golang# foobar",
-			"1.2",
-			"FROM    golang:1.2# foobar",
-		},
-		{
-			"FROM golang:1.13.1",
-			"1.1",
-			"FROM golang:1.1",
-		},
-		{
-			"from golang:1.13.1-alpine",
-			"1.13.3",
-			"from golang:1.13.3-alpine",
-		},
-		{
-			"from golang:1.-werd",
-			"1.13.3",
-			"from golang:1.13.3",
-		},
-	}
-
-	for i, tc := range testcases {
-		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			actual, err := updateDockerfileFromLine([]byte(tc.origLine), tc.newImageTag)
-			if err != nil {
-				t.Errorf("updateDockerfileFromLine error: %s", err)
-				return
-			}
-			if tc.expected != string(actual) {
-				t.Errorf("want %#v, got %#v", tc.expected, string(actual))
+func TestGatherFilesInputs(t *testing.T) {
+	repoFiles := []string{
+		".github/versions/go",
+		".go-version",
+		"Dockerfile",
+		"legacy/Dockerfile",
+		"legacy/keep/Dockerfile",
+		"services/api/Dockerfile",
+	}
+	root := "/repo"
+	os.Setenv("INPUT_EXCLUDE", ".github/versions/go, legacy/**,!legacy/keep/**")
+	defer os.Unsetenv("INPUT_EXCLUDE")
+	os.Setenv("INPUT_DOCKERFILES", "./services/**/Dockerfile,/repo/missing/Dockerfile")
+	defer os.Unsetenv("INPUT_DOCKERFILES")
+
+	// The inputs are the defaults of the flags.
+	opts := &options{}
+	fs := newFlagSet("update", ioutil.Discard, opts)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	excludes, err := ensure.ParseInputPatterns(root, opts.exclude)
+	if err != nil {
+		t.Fatalf("ParseInputPatterns: %s", err)
+	}
+	var included []string
+	for _, u := range ensure.DefaultUpdaters(false) {
+		matches, err := gatherFiles(u, root, repoFiles, opts, excludes)
+		if err != nil {
+			t.Fatalf("gatherFiles: %s", err)
+		}
+		for _, m := range matches {
+			if m.ExcludedBy == "" {
+				included = append(included, m.Path)
 			}
-		})
+		}
+	}
+	expected := []string{".go-version", "missing/Dockerfile", "services/api/Dockerfile"}
+	sort.Strings(included)
+	if !cmp.Equal(expected, included) {
+		t.Errorf("included files: %s", cmp.Diff(expected, included))
+	}
+
+	// Flags override the inputs.
+	opts = &options{}
+	fs = newFlagSet("update", ioutil.Discard, opts)
+	if err := fs.Parse([]string{"--dockerfiles", "legacy/**"}); err != nil {
+		t.Fatalf("Parse: %s", err)
+	}
+	matches, err := gatherFiles(ensure.DockerfileUpdater{}, root, repoFiles, opts, nil)
+	if err != nil {
+		t.Fatalf("gatherFiles: %s", err)
+	}
+	var actual []string
+	for _, m := range matches {
+		actual = append(actual, m.Path)
+	}
+	expected = []string{"legacy/Dockerfile", "legacy/keep/Dockerfile"}
+	if !cmp.Equal(expected, actual) {
+		t.Errorf("dockerfiles flag: %s", cmp.Diff(expected, actual))
 	}
 }
 
-func TestTravisGoldenPath(t *testing.T) {
+func TestRunCommands(t *testing.T) {
+	root, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		".go-version":              "1.21.5\n",
+		"Dockerfile":               "FROM golang:1.21.5-alpine\nRUN true\n",
+		"services/api/.go-version": "1.22.3\n",
+		"services/api/go.mod":      "module example.com/api\n\ngo 1.21\n\ntoolchain go1.22.3\n",
+	}
+	for fp, contents := range files {
+		fp = filepath.Join(root, filepath.FromSlash(fp))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(orig func(*ensure.HTTPClient) ([]ensure.Release, error)) { getReleases = orig }(getReleases)
+	getReleases = func(*ensure.HTTPClient) ([]ensure.Release, error) {
+		return []ensure.Release{{Version: "go1.22.3", Stable: true}}, nil
+	}
+	// Being offline only leaves the release notes out of the changelog.
+	defer func(orig ensure.ReleaseNotesSource) { getReleaseNotes = orig }(getReleaseNotes)
+	getReleaseNotes = func(*ensure.HTTPClient) ([]ensure.ReleaseNote, error) {
+		return nil, errors.New("offline")
+	}
+	outputFile := filepath.Join(root, "github_output")
+	os.Setenv("GITHUB_OUTPUT", outputFile)
+	defer os.Unsetenv("GITHUB_OUTPUT")
+	// Annotations are on by default in GitHub Actions.
+	defer os.Setenv("GITHUB_ACTIONS", os.Getenv("GITHUB_ACTIONS"))
+	os.Unsetenv("GITHUB_ACTIONS")
+	sarifFile := filepath.Join(root, "results.sarif")
+
 	testcases := []struct {
-		input    string
+		args     []string
+		code     int
 		expected string
 	}{
-		{
-			input: `language: go
-go:
-  - 1.13.1
-
-sudo: required
-
-services:
-  - docker
-
-branches:
-  only:
-    - master
-    - /^test_/
-    - /^test-/
-
-install:
-  - go test -race -i .
-
-script:
-  - go test -race . && GOOS=linux GOARCH=amd64 go build -ldflags "-X main.buildSHA=${TRAVIS_COMMIT}" . && ./travis_docker_push.sh
-`,
-			expected: `language: go
-go:
-- "1.22"
-sudo: required
-services:
-- docker
-branches:
-  only:
-  - master
-  - /^test_/
-  - /^test-/
-install:
-- go test -race -i .
-script:
-- go test -race . && GOOS=linux GOARCH=amd64 go build -ldflags "-X main.buildSHA=${TRAVIS_COMMIT}" . && ./travis_docker_push.sh
-`,
-		},
-		{
-			input: `language: go
-go:
-  - 1.13.1
-  - 1.10.0
-
-foobar: foo
-`,
-			expected: `language: go
-go:
-- 1.13.1
-- 1.10.0
-- "1.22"
-foobar: foo
-`,
-		},
-		{
-			input: `language: go
-go: 1.13.1
-branches:
-- nope
-`,
-			expected: `language: go
-go: "1.22"
-branches:
-- nope
-`,
-		},
-
-		{
-			input: `language: go
-branches:
-- nope
-`,
-			expected: `language: go
-branches:
-- nope
-`,
-		},
-	}
-
-	for i, tc := range testcases {
-		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			actualBytes, err := updateSingleTravisFile("fake.yml", []byte(tc.input), "1.22")
-			if err != nil {
-				t.Fatalf("updateSingleTravisFile: %s", err)
+		{[]string{"bogus"}, exitUsage, ""},
+		{[]string{"check", "--nope"}, exitUsage, ""},
+		{[]string{"check", "--root", root}, exitOutOfDate, ".go-version\nDockerfile\n"},
+		{[]string{"check", "--root", root, "--annotate", "--sarif", sarifFile, "--goversionfiles", "nothing/**"}, exitOutOfDate, "Dockerfile\n" +
+			"::warning file=Dockerfile,line=1,col=13,endLine=1,endColumn=19,title=Out of date Go version::Go 1.21.5 is out of date and would be updated to Go 1.22.3.\n"},
+		{[]string{"check", "--root", root, "--annotate", "--vulndb", "../ensure/testdata/vulndb", "--goversionfiles", "nothing/**"}, exitOutOfDate, "Dockerfile\n" +
+			"::error file=Dockerfile,line=1,col=13,endLine=1,endColumn=19,title=Vulnerable Go version::Go 1.21.5 is out of date and would be updated to Go 1.22.3. It's affected by GO-2024-2887 (CVE-2024-24790), GO-2024-2963 (CVE-2024-24791).\n"},
+		{[]string{"check", "--root", root, "--dockerfiles", "nothing/**", "--goversionfiles", "services/**/.go-version"}, exitOK, ""},
+		{[]string{"check", "--root", root, filepath.Join(root, "services")}, exitError, ""},
+		{[]string{"diff", "--root", root, filepath.Join(root, "Dockerfile")}, exitOutOfDate, `--- a/Dockerfile
++++ b/Dockerfile
+@@ -1,2 +1,2 @@
+-FROM golang:1.21.5-alpine
++FROM golang:1.22.3-alpine
+ RUN true
+`},
+		{[]string{"report", "--root", root, "--format", "xml"}, exitUsage, ""},
+		{[]string{"report", "--root", root}, exitOK, `Latest Go release: 1.22.3
+
+LOCATION                  TYPE        VERSION  SUPPORT               STATUS
+.go-version:1:1           goversion   1.21.5   supported-but-behind  1 minor version behind, disagrees with services/api/go.mod:5
+Dockerfile:1:13           dockerfile  1.21.5   supported-but-behind  1 minor version behind, disagrees with services/api/go.mod:5
+services/api/go.mod:5:13  gomod       1.22.3   current               up to date
+`},
+		{[]string{"report", "--root", root, "--format", "markdown", filepath.Join(root, "services")}, exitOK, "Latest Go release: **1.22.3**\n\n" +
+			"| Location | Type | Version | Support | Status |\n| --- | --- | --- | --- | --- |\n" +
+			"| `services/api/go.mod:5:13` | gomod | `1.22.3` | current | up to date |\n"},
+		{[]string{"update", "--root", root, "--exclude", "Dockerfile"}, exitOK, "1.22.3\n"},
+		{[]string{"check", "--root", root}, exitOutOfDate, "Dockerfile\n"},
+	}
+	for _, tc := range testcases {
+		stdout := &bytes.Buffer{}
+		code := run(tc.args, stdout, ioutil.Discard)
+		if code != tc.code {
+			t.Errorf("%q: want exit code %d, got %d", tc.args, tc.code, code)
+		}
+		if tc.expected != stdout.String() {
+			t.Errorf("%q: %s", tc.args, cmp.Diff(tc.expected, stdout.String()))
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(root, ".go-version"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "1.22.3\n" {
+		t.Errorf("update didn't update .go-version: %#v", string(b))
+	}
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID    string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine, StartColumn, EndLine, EndColumn int }
+					}
+				}
 			}
-			actual := string(actualBytes)
-			if tc.expected != actual {
-				t.Errorf("github action file update failed: %s (%s)", cmp.Diff(tc.expected, actual), actual)
+		}
+	}
+	b, err = ioutil.ReadFile(sarifFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &sarif); err != nil {
+		t.Fatalf("unable to parse SARIF file: %s", err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs) != 1 || len(sarif.Runs[0].Results) != 1 {
+		t.Fatalf("SARIF file: %s", b)
+	}
+	loc := sarif.Runs[0].Results[0].Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "Dockerfile" || loc.Region.StartLine != 1 || loc.Region.StartColumn != 13 || loc.Region.EndColumn != 19 {
+		t.Errorf("SARIF location: %+v", loc)
+	}
+
+	b, err = ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := regexp.MustCompile(`ensure_latest_go_[0-9a-f]+`).ReplaceAllString(string(b), "EOF")
+	expectedOutput := "changelog<<EOF\n### Go releases since 1.21.5\n\n- [Go 1.22.3](https://go.dev/doc/devel/release#go1.22.3)\nEOF\n"
+	if diff := cmp.Diff(expectedOutput, output); diff != "" {
+		t.Errorf("GitHub Actions output (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunEndOfLife(t *testing.T) {
+	root, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		".travis.yml":                  "language: go\ngo:\n  - 1.22.3\n  - 1.10.0\n",
+		".github/versions/go":          "1.22.3\n",
+		"legacy/.go-version":           "1.20.5\n",
+		".github/ensure-latest-go.yml": "rules:\n  - paths: [legacy/**]\n    policy: patch\n",
+	}
+	for fp, contents := range files {
+		fp = filepath.Join(root, filepath.FromSlash(fp))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(orig func(*ensure.HTTPClient) ([]ensure.Release, error)) { getReleases = orig }(getReleases)
+	getReleases = func(*ensure.HTTPClient) ([]ensure.Release, error) {
+		return []ensure.Release{{Version: "go1.22.3", Stable: true}, {Version: "go1.20.14", Stable: true}}, nil
+	}
+	defer func(orig ensure.ReleaseNotesSource) { getReleaseNotes = orig }(getReleaseNotes)
+	getReleaseNotes = func(*ensure.HTTPClient) ([]ensure.ReleaseNote, error) {
+		return nil, errors.New("offline")
+	}
+	defer os.Unsetenv("GITHUB_OUTPUT")
+	os.Setenv("GITHUB_OUTPUT", filepath.Join(root, "github_output"))
+
+	// Neither the Travis CI matrix's old entry nor the file held back by the
+	// patch policy get updated, but check still fails on them.
+	stdout := &bytes.Buffer{}
+	args := []string{"check", "--root", root, "--annotate", "--goversionfiles", "legacy/.go-version"}
+	if code := run(args, stdout, ioutil.Discard); code != exitOutOfDate {
+		t.Errorf("check: want exit code %d, got %d", exitOutOfDate, code)
+	}
+	expected := ".travis.yml\nlegacy/.go-version\n" +
+		"::error file=legacy/.go-version,line=1,col=1,endLine=1,endColumn=7,title=End-of-life Go version::Go 1.20.5 is out of date and would be updated to Go 1.20.14. It's end-of-life and no longer gets security fixes.\n" +
+		"::error file=.travis.yml,line=4,col=5,endLine=4,endColumn=11,title=End-of-life Go version::Go 1.10.0 is end-of-life and no longer gets security fixes. Go only supports 1.22 and 1.21. Updating adds newer versions to this list of versions instead of replacing this one, so remove it if it's no longer needed.\n" +
+		"::error file=legacy/.go-version,line=1,col=1,endLine=1,endColumn=7,title=End-of-life Go version::Go 1.20.5 is end-of-life and no longer gets security fixes. Go only supports 1.22 and 1.21. The policy for this file doesn't update it to a supported version.\n"
+	if diff := cmp.Diff(expected, stdout.String()); diff != "" {
+		t.Errorf("check (-want +got):\n%s", diff)
+	}
+
+	stderr := &bytes.Buffer{}
+	args = []string{"update", "--root", root, "--goversionfiles", "legacy/.go-version"}
+	if code := run(args, ioutil.Discard, stderr); code != exitOK {
+		t.Errorf("update: want exit code %d, got %d: %s", exitOK, code, stderr)
+	}
+	for _, want := range []string{".travis.yml:4:5 in travis: Go 1.10.0 is end-of-life", "legacy/.go-version:1:1 in goversion: Go 1.20.14 is end-of-life"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("update: want a warning containing %#v, got %s", want, stderr)
+		}
+	}
+}
+
+// gitCmd runs git in dir as a test user and returns its trimmed output.
+func TestHTTPOptions(t *testing.T) {
+	logger := log.New(ioutil.Discard, "", 0)
+	// The action passes empty inputs as empty flags.
+	ho, err := httpOptions(&options{cacheDir: "/cache"}, logger)
+	if err != nil {
+		t.Fatalf("httpOptions with empty values: %s", err)
+	}
+	if ho.Timeout != ensure.DefaultHTTPTimeout || ho.Retries != ensure.DefaultHTTPRetries || ho.CacheTTL != ensure.DefaultCacheTTL || ho.CacheDir != "/cache" {
+		t.Errorf("httpOptions with empty values: %+v", ho)
+	}
+	ho, err = httpOptions(&options{httpTimeout: "30s", httpRetries: "0", cacheTTL: "1h"}, logger)
+	if err != nil {
+		t.Fatalf("httpOptions: %s", err)
+	}
+	if ho.Timeout != 30*time.Second || ho.Retries != 0 || ho.CacheTTL != time.Hour {
+		t.Errorf("httpOptions: %+v", ho)
+	}
+	if _, err := httpOptions(&options{httpRetries: "-1"}, logger); err == nil {
+		t.Errorf("want an error for negative retries")
+	}
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main", "-C", dir}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %q: %s: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestRunCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	tmp, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	bare := filepath.Join(tmp, "upstream.git")
+	clone := filepath.Join(tmp, "clone")
+	gitCmd(t, tmp, "init", "--bare", bare)
+	gitCmd(t, tmp, "clone", bare, clone)
+	files := map[string]string{
+		".go-version": "1.21.5\n",
+		"Dockerfile":  "FROM golang:1.21.5-alpine\n",
+		"notes.txt":   "notes\n",
+	}
+	for fp, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(clone, fp), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd(t, clone, "add", ".")
+	gitCmd(t, clone, "commit", "-m", "initial")
+	gitCmd(t, clone, "push", "origin", "HEAD")
+	// Changes the tool didn't make shouldn't be committed.
+	if err := ioutil.WriteFile(filepath.Join(clone, "notes.txt"), []byte("more notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, clone, "add", "notes.txt")
+
+	defer func(orig func(*ensure.HTTPClient) ([]ensure.Release, error)) { getReleases = orig }(getReleases)
+	getReleases = func(*ensure.HTTPClient) ([]ensure.Release, error) {
+		return []ensure.Release{{Version: "go1.22.3", Stable: true}}, nil
+	}
+	defer func(orig ensure.ReleaseNotesSource) { getReleaseNotes = orig }(getReleaseNotes)
+	getReleaseNotes = func(*ensure.HTTPClient) ([]ensure.ReleaseNote, error) { return nil, nil }
+	args := []string{"update", "--root", clone, "--commit", "--push", "--commitmessage", "Go {{.GoVersion}}: {{range .Files}}{{.}} {{end}}"}
+	stderr := &bytes.Buffer{}
+	if code := run(args, ioutil.Discard, stderr); code != exitOK {
+		t.Fatalf("update exited with %d: %s", code, stderr)
+	}
+	branch := "ensure-latest-go/patch-1.22.3"
+	if actual := gitCmd(t, bare, "log", "-1", "--format=%s", branch); actual != "Go 1.22.3: .go-version Dockerfile" {
+		t.Errorf("commit message: %#v", actual)
+	}
+	if actual := gitCmd(t, bare, "show", "--format=%an", "--name-only", branch); actual != "github-actions[bot]\n\n.go-version\nDockerfile" {
+		t.Errorf("commit author and files: %#v", actual)
+	}
+	if actual := gitCmd(t, clone, "diff", "--cached", "--name-only"); actual != "notes.txt" {
+		t.Errorf("staged files after commit: %#v", actual)
+	}
+
+	// A failed write leaves the checkout on the branch it was on.
+	clone3 := filepath.Join(tmp, "clone3")
+	gitCmd(t, tmp, "clone", bare, clone3)
+	gitCmd(t, clone3, "checkout", "-b", "work")
+	defer func(orig func([]ensure.FileContent) error) { writeFiles = orig }(writeFiles)
+	writeFiles = func([]ensure.FileContent) error { return fmt.Errorf("disk on fire") }
+	stderr.Reset()
+	if code := run([]string{"update", "--root", clone3, "--commit", "--remote", "nowhere"}, ioutil.Discard, stderr); code == exitOK {
+		t.Fatalf("update with a failed write exited OK")
+	}
+	if !strings.Contains(stderr.String(), "disk on fire") {
+		t.Errorf("update with a failed write didn't report it: %s", stderr)
+	}
+	if actual := gitCmd(t, clone3, "symbolic-ref", "--short", "HEAD"); actual != "work" {
+		t.Errorf("branch after a failed write: %#v", actual)
+	}
+	if actual := gitCmd(t, clone3, "branch", "--list", "ensure-latest-go/*"); actual != "" {
+		t.Errorf("branches created by a failed write: %#v", actual)
+	}
+	writeFiles = ensure.WriteFiles
+
+	// A second run against the same upstream skips the existing branch.
+	clone2 := filepath.Join(tmp, "clone2")
+	gitCmd(t, tmp, "clone", bare, clone2)
+	stderr.Reset()
+	if code := run([]string{"update", "--root", clone2, "--commit"}, ioutil.Discard, stderr); code != exitOK {
+		t.Fatalf("second update exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stderr.String(), "already exists") {
+		t.Errorf("second update didn't skip the existing branch: %s", stderr)
+	}
+	if actual := gitCmd(t, clone2, "status", "--porcelain"); actual != "" {
+		t.Errorf("second update changed files: %#v", actual)
+	}
+}
+
+// fakeGitHub is an httptest fake of the GitHub REST API's pull requests.
+type fakeGitHub struct {
+	prs      []map[string]interface{}
+	requests []string
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/repos/o/r/pulls":
+		json.NewEncoder(w).Encode(f.prs)
+	case r.Method == "POST" && r.URL.Path == "/repos/o/r/pulls":
+		body["number"] = len(f.prs) + 1
+		body["html_url"] = fmt.Sprintf("https://github.com/o/r/pull/%d", len(f.prs)+1)
+		body["head"] = map[string]interface{}{"ref": body["head"]}
+		f.prs = append(f.prs, body)
+		json.NewEncoder(w).Encode(body)
+	case r.Method == "PATCH" && strings.HasPrefix(r.URL.Path, "/repos/o/r/pulls/"):
+		pr := f.prs[len(f.prs)-1]
+		pr["title"], pr["body"] = body["title"], body["body"]
+		json.NewEncoder(w).Encode(pr)
+	default:
+		fmt.Fprint(w, "{}")
+	}
+}
+
+func TestRunPullRequest(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	tmp, err := ioutil.TempDir("", "ensure-latest-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	bare := filepath.Join(tmp, "upstream.git")
+	clone := filepath.Join(tmp, "clone")
+	gitCmd(t, tmp, "init", "--bare", bare)
+	gitCmd(t, tmp, "clone", bare, clone)
+	if err := ioutil.WriteFile(filepath.Join(clone, ".go-version"), []byte("1.21.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, clone, "add", ".")
+	gitCmd(t, clone, "commit", "-m", "initial")
+	gitCmd(t, clone, "push", "origin", "HEAD")
+	base := gitCmd(t, clone, "symbolic-ref", "--short", "HEAD")
+
+	gh := &fakeGitHub{}
+	srv := httptest.NewServer(gh)
+	defer srv.Close()
+	defer func(orig func(*ensure.HTTPClient) ([]ensure.Release, error)) { getReleases = orig }(getReleases)
+	defer func(orig ensure.ReleaseNotesSource) { getReleaseNotes = orig }(getReleaseNotes)
+	getReleaseNotes = func(*ensure.HTTPClient) ([]ensure.ReleaseNote, error) {
+		return []ensure.ReleaseNote{
+			{Version: "go1.22.3", Date: "2024-05-07", Security: true, Summary: "includes security fixes to the net/http package."},
+			{Version: "go1.22.2", Date: "2024-04-03", Summary: "includes bug fixes to the runtime."},
+		}, nil
+	}
+	update := func(goVers string) {
+		t.Helper()
+		getReleases = func(*ensure.HTTPClient) ([]ensure.Release, error) {
+			var releases []ensure.Release
+			for _, v := range []string{"go1.22.3", "go1.22.2", "go1.21.5"} {
+				if v <= "go"+goVers {
+					releases = append(releases, ensure.Release{Version: v, Stable: true})
+				}
 			}
-		})
+			return releases, nil
+		}
+		dir, err := ioutil.TempDir(tmp, "clone")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gitCmd(t, tmp, "clone", bare, dir)
+		args := []string{"update", "--root", dir, "--pullrequest", "--repository", "o/r", "--githubapiurl", srv.URL, "--labels", "dependencies, go", "--reviewers", "octocat"}
+		stderr := &bytes.Buffer{}
+		if code := run(args, ioutil.Discard, stderr); code != exitOK {
+			t.Fatalf("update to %s exited with %d: %s", goVers, code, stderr)
+		}
 	}
 
+	update("1.22.2")
+	update("1.22.3")
+	update("1.22.3")
+
+	expectedRequests := []string{
+		"GET /repos/o/r/pulls",
+		"POST /repos/o/r/pulls",
+		"POST /repos/o/r/issues/1/labels",
+		"POST /repos/o/r/pulls/1/requested_reviewers",
+		// The next patch release updates the same pull request.
+		"GET /repos/o/r/pulls",
+		"PATCH /repos/o/r/pulls/1",
+		"POST /repos/o/r/issues/1/labels",
+		"POST /repos/o/r/pulls/1/requested_reviewers",
+		// And then there's nothing to do until the next release.
+		"GET /repos/o/r/pulls",
+	}
+	if diff := cmp.Diff(expectedRequests, gh.requests); diff != "" {
+		t.Errorf("API requests (-want +got):\n%s", diff)
+	}
+	if len(gh.prs) != 1 {
+		t.Fatalf("pull requests: %#v", gh.prs)
+	}
+	pr := gh.prs[0]
+	expectedBody := `Updates Go from 1.21.5 to 1.22.3.
+
+Updated files:
+
+- ` + "`.go-version`" + `
+
+### Go releases since 1.21.5
+
+- [Go 1.22.3](https://go.dev/doc/devel/release#go1.22.3) (2024-05-07) **security release**: includes security fixes to the net/http package.
+- [Go 1.22.2](https://go.dev/doc/devel/release#go1.22.2) (2024-04-03): includes bug fixes to the runtime.
+
+<!-- ensure-latest-go: 1.22.3 -->
+`
+	if pr["title"] != "update to latest Go release 1.22.3" || pr["body"] != expectedBody || pr["base"] != base {
+		t.Errorf("pull request: %#v", pr)
+	}
+	branch := "ensure-latest-go/patch-1.22.2"
+	if pr["head"].(map[string]interface{})["ref"] != branch {
+		t.Errorf("pull request head: %#v", pr["head"])
+	}
+	if actual := gitCmd(t, bare, "show", branch+":.go-version"); actual != "1.22.3" {
+		t.Errorf("pull request branch's .go-version: %#v", actual)
+	}
+	if actual := gitCmd(t, bare, "rev-list", "--count", branch); actual != "2" {
+		t.Errorf("pull request branch has %s commits instead of replacing the earlier release's", actual)
+	}
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jmhodges/ensure-latest-go/ensure"
+)
+
+// reportFormats are the output formats of the report command.
+var reportFormats = []string{"text", "json", "markdown"}
+
+// printReport writes the report of the pins, in file order, in the given
+// format.
+func printReport(w io.Writer, format string, pins []ensure.PinReport, releases []ensure.Release) error {
+	sort.SliceStable(pins, func(i, j int) bool {
+		if pins[i].Path != pins[j].Path {
+			return pins[i].Path < pins[j].Path
+		}
+		return pins[i].Line < pins[j].Line
+	})
+	r := ensure.NewReport(pins, releases)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "markdown":
+		return printMarkdownReport(w, r)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Latest Go release: %s\n\n", r.Latest)
+	fmt.Fprintln(tw, "LOCATION\tTYPE\tVERSION\tSUPPORT\tSTATUS")
+	for _, p := range r.Pins {
+		status := p.Behind()
+		if p.DisagreesWith != "" {
+			status += ", disagrees with " + p.DisagreesWith
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Location(), p.Type, versionOrDash(p.Version), versionOrDash(p.Support), status)
+	}
+	return tw.Flush()
+}
+
+func printMarkdownReport(w io.Writer, r ensure.Report) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Latest Go release: **%s**\n\n", r.Latest)
+	sb.WriteString("| Location | Type | Version | Support | Status |\n| --- | --- | --- | --- | --- |\n")
+	for _, p := range r.Pins {
+		version := versionOrDash(p.Version)
+		if p.Version != "" {
+			version = "`" + version + "`"
+		}
+		status := p.Behind()
+		if p.DisagreesWith != "" {
+			status += ", **disagrees with** `" + p.DisagreesWith + "`"
+		}
+		support := versionOrDash(p.Support)
+		if p.Support == ensure.SupportEOL {
+			support = "**" + support + "**"
+		}
+		fmt.Fprintf(&sb, "| `%s` | %s | %s | %s | %s |\n", p.Location(), p.Type, version, support, status)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func versionOrDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}